@@ -0,0 +1,119 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api generates JSON Schemas for the versioned output types in the
+// v1 and v2 packages.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Versions returns the output versions a schema is available for.
+func Versions() []string {
+	return []string{apiv1.Version, apiv2.Version}
+}
+
+// Schema returns the JSON Schema of the output for a version.
+func Schema(version string) ([]byte, error) {
+	switch version {
+	case apiv1.Version:
+		return generate(apiv1.ClusterMetrics{}, "kube-capacity output "+version)
+	case apiv2.Version:
+		return generate(apiv2.ClusterMetrics{}, "kube-capacity output "+version)
+	}
+	return nil, fmt.Errorf("Unsupported Output Version. We only support: %v", Versions())
+}
+
+// schema is the subset of JSON Schema needed to describe the output types.
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Definitions          map[string]*schema `json:"$defs,omitempty"`
+}
+
+// generate reflects over the JSON tags of v. Each struct is added to $defs by
+// name and referred to with $ref, and fields without omitempty are required.
+func generate(v interface{}, title string) ([]byte, error) {
+	definitions := map[string]*schema{}
+	root := typeSchema(reflect.TypeOf(v), definitions)
+
+	return json.MarshalIndent(&schema{
+		Schema:      draft,
+		Title:       title,
+		Ref:         root.Ref,
+		Definitions: definitions,
+	}, "", "  ")
+}
+
+func typeSchema(t reflect.Type, definitions map[string]*schema) *schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), definitions)
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Slice:
+		return &schema{Type: "array", Items: typeSchema(t.Elem(), definitions)}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), definitions)}
+	case reflect.Struct:
+		ref := &schema{Ref: "#/$defs/" + t.Name()}
+		if _, ok := definitions[t.Name()]; ok {
+			return ref
+		}
+
+		s := &schema{Type: "object", Properties: map[string]*schema{}}
+		// Added before the fields to stop recursive types looping forever.
+		definitions[t.Name()] = s
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			s.Properties[name] = typeSchema(field.Type, definitions)
+			if !strings.Contains(opts, "omitempty") {
+				s.Required = append(s.Required, name)
+			}
+		}
+		return ref
+	}
+
+	panic(fmt.Sprintf("unsupported type %s in output schema", t))
+}
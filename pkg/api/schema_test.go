@@ -0,0 +1,62 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The schemas in testdata are the published contract. If a change to the
+// output types is intended, regenerate them with:
+//
+//	go run . schema --output-version v2 > pkg/api/testdata/v2.schema.json
+func TestSchemaMatchesPublished(t *testing.T) {
+	for _, version := range Versions() {
+		expected, err := os.ReadFile(filepath.Join("testdata", version+".schema.json"))
+		assert.NoError(t, err)
+
+		actual, err := Schema(version)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual)+"\n", "schema for %s changed", version)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	raw, err := Schema("v2")
+	assert.NoError(t, err)
+
+	var s schema
+	assert.NoError(t, json.Unmarshal(raw, &s))
+	assert.Equal(t, draft, s.Schema)
+	assert.Equal(t, "#/$defs/ClusterMetrics", s.Ref)
+
+	resource := s.Definitions["ResourceOutput"]
+	assert.Equal(t, "integer", resource.Properties["requests"].Type)
+	assert.Equal(t, "number", resource.Properties["requestsPercent"].Type)
+	assert.Equal(t, []string{"allocatable", "requests", "requestsPercent", "limits", "limitsPercent"}, resource.Required)
+
+	node := s.Definitions["NodeMetric"]
+	assert.Equal(t, "object", node.Properties["resources"].Type)
+	assert.Equal(t, "#/$defs/ResourceOutput", node.Properties["resources"].AdditionalProperties.Ref)
+	assert.Equal(t, "#/$defs/Pod", node.Properties["pods"].Items.Ref)
+
+	_, err = Schema("v3")
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v1 contains the types of the default JSON and YAML output of
+// kube-capacity. Values are formatted like the table output, e.g. "220m" and
+// "22%". Fields are only ever added to this version, never changed or removed.
+package v1
+
+// Version is the output version these types describe.
+const Version = "v1"
+
+// ClusterMetrics is the top level of the output. Exactly one of Nodes,
+// NodeGroups, Namespaces or Workloads is set, depending on how the output is
+// grouped. Nodes is always present, as an empty list when the output is
+// grouped. Pending is only set when pending pods were collected.
+type ClusterMetrics struct {
+	Nodes         []*NodeMetric      `json:"nodes"`
+	NodeGroups    []*NodeGroupMetric `json:"nodeGroups,omitempty"`
+	Namespaces    []*NamespaceMetric `json:"namespaces,omitempty"`
+	Workloads     []*WorkloadMetric  `json:"workloads,omitempty"`
+	Pending       *PendingMetric     `json:"pending,omitempty"`
+	ClusterTotals *ClusterTotals     `json:"clusterTotals"`
+}
+
+// ClusterTotals holds the totals for every node in the output, and when
+// overhead is shown, for the pods using each RuntimeClass.
+type ClusterTotals struct {
+	CPU            *ResourceOutput            `json:"cpu,omitempty"`
+	Memory         *ResourceOutput            `json:"memory,omitempty"`
+	Resources      map[string]*ResourceOutput `json:"resources,omitempty"`
+	PodCount       string                     `json:"podCount,omitempty"`
+	RuntimeClasses []*RuntimeClassMetric      `json:"runtimeClasses,omitempty"`
+}
+
+// RuntimeClassMetric holds the totals for the scheduled pods using a
+// RuntimeClass. Percentages are relative to the whole cluster.
+type RuntimeClassMetric struct {
+	Name      string                     `json:"name"`
+	Pods      int64                      `json:"pods"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+}
+
+// NodeMetric holds the totals for a node and optionally its pods.
+type NodeMetric struct {
+	Name      string                     `json:"name"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  string                     `json:"podCount,omitempty"`
+}
+
+// NodeGroupMetric holds the totals for nodes sharing a value of a label.
+type NodeGroupMetric struct {
+	Label     string                     `json:"label"`
+	Value     string                     `json:"value"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+	Nodes     []*NodeMetric              `json:"nodes"`
+	PodCount  string                     `json:"podCount,omitempty"`
+}
+
+// NamespaceMetric holds the totals for the pods in a namespace.
+type NamespaceMetric struct {
+	Name      string                     `json:"name"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  string                     `json:"podCount,omitempty"`
+}
+
+// WorkloadMetric holds the totals for the pods of a workload.
+type WorkloadMetric struct {
+	Name      string                     `json:"name"`
+	Namespace string                     `json:"namespace"`
+	Kind      string                     `json:"kind"`
+	Replicas  int64                      `json:"replicas"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  string                     `json:"podCount,omitempty"`
+}
+
+// Pod holds the totals for a pod and optionally its containers, along with
+// how its requests follow from them.
+type Pod struct {
+	Name              string                        `json:"name"`
+	Namespace         string                        `json:"namespace"`
+	CPU               *ResourceOutput               `json:"cpu,omitempty"`
+	Memory            *ResourceOutput               `json:"memory,omitempty"`
+	Resources         map[string]*ResourceOutput    `json:"resources,omitempty"`
+	EffectiveRequests map[string]*EffectiveRequests `json:"effectiveRequests,omitempty"`
+	Containers        []Container                   `json:"containers,omitempty"`
+}
+
+// PendingMetric holds the totals for pods that are not scheduled on a node
+// yet. They are not included in the cluster totals, and percentages are
+// relative to the allocatable amount of the whole cluster.
+type PendingMetric struct {
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+	Pods      []*PendingPod              `json:"pods,omitempty"`
+	PodCount  string                     `json:"podCount,omitempty"`
+}
+
+// PendingPod holds the totals for a pod that is not scheduled yet, how long
+// ago it was created and why the scheduler has not placed it, e.g.
+// "Unschedulable".
+type PendingPod struct {
+	Name              string                        `json:"name"`
+	Namespace         string                        `json:"namespace"`
+	Age               string                        `json:"age"`
+	Reason            string                        `json:"reason,omitempty"`
+	Message           string                        `json:"message,omitempty"`
+	CPU               *ResourceOutput               `json:"cpu,omitempty"`
+	Memory            *ResourceOutput               `json:"memory,omitempty"`
+	Resources         map[string]*ResourceOutput    `json:"resources,omitempty"`
+	EffectiveRequests map[string]*EffectiveRequests `json:"effectiveRequests,omitempty"`
+	Containers        []Container                   `json:"containers,omitempty"`
+}
+
+// EffectiveRequests shows how the request of a pod for a resource follows
+// from its containers. Init containers run one at a time before the app
+// containers start, and sidecars keep running alongside the app containers
+// once started. The scheduler reserves the larger of the summed requests of
+// the app containers and sidecars and the most needed while the init
+// containers start, plus the pod overhead. Ephemeral containers are not
+// counted.
+type EffectiveRequests struct {
+	Containers     string `json:"containers"`
+	Sidecars       string `json:"sidecars"`
+	InitContainers string `json:"initContainers"`
+	Overhead       string `json:"overhead"`
+	Effective      string `json:"effective"`
+}
+
+// Container holds the values for a container. Type is "app", "init",
+// "sidecar" or "ephemeral".
+type Container struct {
+	Name      string                     `json:"name"`
+	Type      string                     `json:"type,omitempty"`
+	CPU       *ResourceOutput            `json:"cpu,omitempty"`
+	Memory    *ResourceOutput            `json:"memory,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources,omitempty"`
+}
+
+// ResourceOutput holds the formatted values of a resource. Percentages are
+// relative to the allocatable amount of the node or nodes the values are for.
+// Overhead is the part of Requests that is pod overhead from a RuntimeClass,
+// and is only set when overhead was requested.
+type ResourceOutput struct {
+	Requests       string `json:"requests"`
+	RequestsPct    string `json:"requestsPercent"`
+	Limits         string `json:"limits"`
+	LimitsPct      string `json:"limitsPercent"`
+	Overhead       string `json:"overhead,omitempty"`
+	OverheadPct    string `json:"overheadPercent,omitempty"`
+	Utilization    string `json:"utilization,omitempty"`
+	UtilizationPct string `json:"utilizationPercent,omitempty"`
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const clusterMetricsJSON = `{
+  "nodes": [
+    {
+      "name": "example-node-1",
+      "cpu": {"requests": "650m", "requestsPercent": "65%", "limits": "810m", "limitsPercent": "81%"},
+      "memory": {"requests": "410Mi", "requestsPercent": "10%", "limits": "580Mi", "limitsPercent": "14%",
+        "utilization": "299Mi", "utilizationPercent": "7%"},
+      "resources": {"nvidia.com/gpu": {"requests": "1", "requestsPercent": "50%", "limits": "1", "limitsPercent": "50%"}},
+      "pods": [
+        {
+          "name": "example-pod",
+          "namespace": "default",
+          "cpu": {"requests": "650m", "requestsPercent": "65%", "limits": "810m", "limitsPercent": "81%"},
+          "containers": [
+            {"name": "example-container", "cpu": {"requests": "650m", "requestsPercent": "65%", "limits": "810m", "limitsPercent": "81%"}}
+          ]
+        }
+      ],
+      "podCount": "1/110"
+    }
+  ],
+  "clusterTotals": {
+    "cpu": {"requests": "650m", "requestsPercent": "65%", "limits": "810m", "limitsPercent": "81%"},
+    "podCount": "1/110"
+  }
+}`
+
+func TestClusterMetricsRoundTrip(t *testing.T) {
+	decoder := json.NewDecoder(bytes.NewBufferString(clusterMetricsJSON))
+	decoder.DisallowUnknownFields()
+
+	var cm ClusterMetrics
+	assert.NoError(t, decoder.Decode(&cm))
+	assert.Equal(t, "650m", cm.Nodes[0].CPU.Requests)
+	assert.Equal(t, "7%", cm.Nodes[0].Memory.UtilizationPct)
+	assert.Equal(t, "1", cm.Nodes[0].Resources["nvidia.com/gpu"].Requests)
+	assert.Equal(t, "example-container", cm.Nodes[0].Pods[0].Containers[0].Name)
+
+	raw, err := json.Marshal(&cm)
+	assert.NoError(t, err)
+	assert.JSONEq(t, clusterMetricsJSON, string(raw))
+}
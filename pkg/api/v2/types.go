@@ -0,0 +1,171 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package v2 contains the types of the JSON and YAML output of kube-capacity
+// with --output-version v2. It mirrors v1, but values are numbers in
+// millicores for CPU and bytes for memory, every level holds allocatable in a
+// map of resources, and pod counts are split into current and allocatable.
+// Fields are only ever added to this version, never changed or removed.
+package v2
+
+// Version is the output version these types describe.
+const Version = "v2"
+
+// ClusterMetrics is the top level of the output. Exactly one of Nodes,
+// NodeGroups, Namespaces or Workloads is set, depending on how the output is
+// grouped. Pending is only set when pending pods were collected.
+type ClusterMetrics struct {
+	Version       string             `json:"version"`
+	Nodes         []*NodeMetric      `json:"nodes,omitempty"`
+	NodeGroups    []*NodeGroupMetric `json:"nodeGroups,omitempty"`
+	Namespaces    []*NamespaceMetric `json:"namespaces,omitempty"`
+	Workloads     []*WorkloadMetric  `json:"workloads,omitempty"`
+	Pending       *PendingMetric     `json:"pending,omitempty"`
+	ClusterTotals *ClusterTotals     `json:"clusterTotals"`
+}
+
+// ClusterTotals holds the totals for every node in the output, and when
+// overhead is shown, which ClusterCapacity.ClusterMetrics always does, for the
+// pods using each RuntimeClass.
+type ClusterTotals struct {
+	Resources      map[string]*ResourceOutput `json:"resources"`
+	PodCount       *PodCount                  `json:"podCount,omitempty"`
+	RuntimeClasses []*RuntimeClassMetric      `json:"runtimeClasses,omitempty"`
+}
+
+// RuntimeClassMetric holds the totals for the scheduled pods using a
+// RuntimeClass. Allocatable is that of the whole cluster.
+type RuntimeClassMetric struct {
+	Name      string                     `json:"name"`
+	Pods      int64                      `json:"pods"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+}
+
+// NodeMetric holds the totals for a node and optionally its pods.
+type NodeMetric struct {
+	Name      string                     `json:"name"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  *PodCount                  `json:"podCount,omitempty"`
+}
+
+// NodeGroupMetric holds the totals for nodes sharing a value of a label.
+type NodeGroupMetric struct {
+	Label     string                     `json:"label"`
+	Value     string                     `json:"value"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+	Nodes     []*NodeMetric              `json:"nodes"`
+	PodCount  *PodCount                  `json:"podCount,omitempty"`
+}
+
+// NamespaceMetric holds the totals for the pods in a namespace.
+type NamespaceMetric struct {
+	Name      string                     `json:"name"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  *PodCount                  `json:"podCount,omitempty"`
+}
+
+// WorkloadMetric holds the totals for the pods of a workload.
+type WorkloadMetric struct {
+	Name      string                     `json:"name"`
+	Namespace string                     `json:"namespace"`
+	Kind      string                     `json:"kind"`
+	Replicas  int64                      `json:"replicas"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+	Pods      []*Pod                     `json:"pods,omitempty"`
+	PodCount  *PodCount                  `json:"podCount,omitempty"`
+}
+
+// Pod holds the totals for a pod and optionally its containers, along with
+// how its requests follow from them.
+type Pod struct {
+	Name              string                        `json:"name"`
+	Namespace         string                        `json:"namespace"`
+	Resources         map[string]*ResourceOutput    `json:"resources"`
+	EffectiveRequests map[string]*EffectiveRequests `json:"effectiveRequests,omitempty"`
+	Containers        []*Container                  `json:"containers,omitempty"`
+}
+
+// PendingMetric holds the totals for pods that are not scheduled on a node
+// yet. They are not included in the cluster totals, and allocatable is that
+// of the whole cluster.
+type PendingMetric struct {
+	Resources map[string]*ResourceOutput `json:"resources"`
+	Pods      []*PendingPod              `json:"pods,omitempty"`
+	PodCount  *PodCount                  `json:"podCount,omitempty"`
+}
+
+// PendingPod holds the totals for a pod that is not scheduled yet, how many
+// seconds ago it was created and why the scheduler has not placed it, e.g.
+// "Unschedulable".
+type PendingPod struct {
+	Name              string                        `json:"name"`
+	Namespace         string                        `json:"namespace"`
+	AgeSeconds        int64                         `json:"ageSeconds"`
+	Reason            string                        `json:"reason,omitempty"`
+	Message           string                        `json:"message,omitempty"`
+	Resources         map[string]*ResourceOutput    `json:"resources"`
+	EffectiveRequests map[string]*EffectiveRequests `json:"effectiveRequests,omitempty"`
+	Containers        []*Container                  `json:"containers,omitempty"`
+}
+
+// EffectiveRequests shows how the request of a pod for a resource follows
+// from its containers, in the unit of the resource. Init containers run one
+// at a time before the app containers start, and sidecars keep running
+// alongside the app containers once started. The scheduler reserves the
+// larger of the summed requests of the app containers and sidecars and the
+// most needed while the init containers start, plus the pod overhead.
+// Ephemeral containers are not counted.
+type EffectiveRequests struct {
+	Containers     int64 `json:"containers"`
+	Sidecars       int64 `json:"sidecars"`
+	InitContainers int64 `json:"initContainers"`
+	Overhead       int64 `json:"overhead"`
+	Effective      int64 `json:"effective"`
+}
+
+// Container holds the values for a container. Type is "app", "init",
+// "sidecar" or "ephemeral".
+type Container struct {
+	Name      string                     `json:"name"`
+	Type      string                     `json:"type,omitempty"`
+	Resources map[string]*ResourceOutput `json:"resources"`
+}
+
+// ResourceOutput holds the values of a resource. Unit is "millicores" for
+// CPU, "bytes" for memory and storage, and empty for counted resources.
+// Percentages are relative to Allocatable and rounded to two decimal places.
+// Overhead is the part of Requests that is pod overhead from a RuntimeClass.
+// Printed output only sets Overhead when it was requested with --overhead,
+// while ClusterCapacity.ClusterMetrics always sets it. Utilization is only set
+// when it was collected.
+type ResourceOutput struct {
+	Unit               string   `json:"unit,omitempty"`
+	Allocatable        int64    `json:"allocatable"`
+	Requests           int64    `json:"requests"`
+	RequestsPercent    float64  `json:"requestsPercent"`
+	Limits             int64    `json:"limits"`
+	LimitsPercent      float64  `json:"limitsPercent"`
+	Overhead           *int64   `json:"overhead,omitempty"`
+	OverheadPercent    *float64 `json:"overheadPercent,omitempty"`
+	Utilization        *int64   `json:"utilization,omitempty"`
+	UtilizationPercent *float64 `json:"utilizationPercent,omitempty"`
+}
+
+// PodCount holds the number of pods and how many pods are allocatable.
+type PodCount struct {
+	Current     int64 `json:"current"`
+	Allocatable int64 `json:"allocatable"`
+}
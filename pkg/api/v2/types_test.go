@@ -0,0 +1,80 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const clusterMetricsJSON = `{
+  "version": "v2",
+  "workloads": [
+    {
+      "name": "web",
+      "namespace": "default",
+      "kind": "Deployment",
+      "replicas": 2,
+      "resources": {
+        "cpu": {"unit": "millicores", "allocatable": 2000, "requests": 400, "requestsPercent": 20,
+          "limits": 800, "limitsPercent": 40, "utilization": 150, "utilizationPercent": 7.5},
+        "nvidia.com/gpu": {"allocatable": 4, "requests": 1, "requestsPercent": 25, "limits": 1, "limitsPercent": 25}
+      },
+      "pods": [
+        {
+          "name": "web-1",
+          "namespace": "default",
+          "resources": {
+            "memory": {"unit": "bytes", "allocatable": 4194304000, "requests": 134217728, "requestsPercent": 3.2,
+              "limits": 268435456, "limitsPercent": 6.4}
+          },
+          "containers": [
+            {"name": "web", "resources": {"memory": {"unit": "bytes", "allocatable": 4194304000, "requests": 134217728,
+              "requestsPercent": 3.2, "limits": 268435456, "limitsPercent": 6.4}}}
+          ]
+        }
+      ],
+      "podCount": {"current": 2, "allocatable": 220}
+    }
+  ],
+  "clusterTotals": {
+    "resources": {
+      "cpu": {"unit": "millicores", "allocatable": 2000, "requests": 400, "requestsPercent": 20,
+        "limits": 800, "limitsPercent": 40}
+    },
+    "podCount": {"current": 2, "allocatable": 220}
+  }
+}`
+
+func TestClusterMetricsRoundTrip(t *testing.T) {
+	decoder := json.NewDecoder(bytes.NewBufferString(clusterMetricsJSON))
+	decoder.DisallowUnknownFields()
+
+	var cm ClusterMetrics
+	assert.NoError(t, decoder.Decode(&cm))
+	assert.Equal(t, Version, cm.Version)
+	assert.Equal(t, int64(400), cm.Workloads[0].Resources["cpu"].Requests)
+	assert.Equal(t, 7.5, *cm.Workloads[0].Resources["cpu"].UtilizationPercent)
+	assert.Nil(t, cm.Workloads[0].Resources["nvidia.com/gpu"].Utilization)
+	assert.Equal(t, int64(134217728), cm.Workloads[0].Pods[0].Containers[0].Resources["memory"].Requests)
+	assert.Equal(t, &PodCount{Current: 2, Allocatable: 220}, cm.ClusterTotals.PodCount)
+
+	raw, err := json.Marshal(&cm)
+	assert.NoError(t, err)
+	assert.JSONEq(t, clusterMetricsJSON, string(raw))
+}
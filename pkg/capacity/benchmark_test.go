@@ -0,0 +1,168 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// The benchmark cluster is the size of the largest clusters kube-capacity is
+// run against, with 30 pods of 2 containers on each of 5k nodes.
+const (
+	benchmarkNodes       = 5000
+	benchmarkPodsPerNode = 30
+)
+
+var (
+	benchmarkOnce     sync.Once
+	benchmarkNodeList *corev1.NodeList
+	benchmarkPodList  *corev1.PodList
+	benchmarkPMList   *v1beta1.PodMetricsList
+)
+
+// Run with: go test ./pkg/capacity -run '^$' -bench . -benchmem
+
+func BenchmarkBuildClusterMetric(b *testing.B) {
+	nodeList, podList, pmList := benchmarkCluster()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buildClusterMetric(podList, pmList, nodeList, nil, DefaultResources)
+	}
+}
+
+func BenchmarkPrintTable(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{})
+}
+
+func BenchmarkPrintTablePods(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{ShowPods: true, ShowUtil: true})
+}
+
+func BenchmarkPrintTableNamespaces(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{GroupBy: NamespaceGrouping, ShowPods: true})
+}
+
+func BenchmarkPrintJSON(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{Output: JSONOutput, ShowPods: true, ShowUtil: true})
+}
+
+func BenchmarkPrintJSONV2(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{Output: JSONOutput, OutputVersion: OutputVersionV2, ShowPods: true, ShowUtil: true})
+}
+
+func BenchmarkPrintCSV(b *testing.B) {
+	benchmarkPrint(b, PrintOptions{Output: CSVOutput, ShowPods: true, ShowUtil: true})
+}
+
+func benchmarkPrint(b *testing.B, opts PrintOptions) {
+	nodeList, podList, pmList := benchmarkCluster()
+	cc := &ClusterCapacity{
+		options: Options{Utilization: true},
+		cm:      buildClusterMetric(podList, pmList, nodeList, nil, DefaultResources),
+	}
+
+	printer, err := NewPrinter(opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := printer.Print(io.Discard, cc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkCluster returns the synthetic nodes, pods and pod metrics of the
+// benchmark cluster, generating them the first time.
+func benchmarkCluster() (*corev1.NodeList, *corev1.PodList, *v1beta1.PodMetricsList) {
+	benchmarkOnce.Do(func() {
+		benchmarkNodeList = &corev1.NodeList{}
+		benchmarkPodList = &corev1.PodList{}
+		benchmarkPMList = &v1beta1.PodMetricsList{}
+
+		for n := 0; n < benchmarkNodes; n++ {
+			nodeName := fmt.Sprintf("node-%05d", n)
+			benchmarkNodeList.Items = append(benchmarkNodeList.Items, corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   nodeName,
+					Labels: map[string]string{"topology.kubernetes.io/zone": fmt.Sprintf("zone-%d", n%3)},
+				},
+				Status: corev1.NodeStatus{
+					Allocatable: corev1.ResourceList{
+						"cpu":    resource.MustParse("16"),
+						"memory": resource.MustParse("64Gi"),
+						"pods":   resource.MustParse("110"),
+					},
+				},
+			})
+
+			for p := 0; p < benchmarkPodsPerNode; p++ {
+				namespace := fmt.Sprintf("namespace-%d", p%20)
+				name := fmt.Sprintf("pod-%05d-%02d", n, p)
+				benchmarkPodList.Items = append(benchmarkPodList.Items, benchmarkPod(nodeName, namespace, name))
+				benchmarkPMList.Items = append(benchmarkPMList.Items, v1beta1.PodMetrics{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+					Containers: []v1beta1.ContainerMetrics{
+						{Name: "app", Usage: corev1.ResourceList{"cpu": resource.MustParse("150m"), "memory": resource.MustParse("200Mi")}},
+						{Name: "sidecar", Usage: corev1.ResourceList{"cpu": resource.MustParse("10m"), "memory": resource.MustParse("20Mi")}},
+					},
+				})
+			}
+		}
+	})
+
+	return benchmarkNodeList, benchmarkPodList, benchmarkPMList
+}
+
+func benchmarkPod(nodeName, namespace, name string) corev1.Pod {
+	container := func(name, cpu, memory string) corev1.Container {
+		return corev1.Container{
+			Name: name,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)},
+				Limits:   corev1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse(memory)},
+			},
+		}
+	}
+
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": namespace},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   nodeName,
+			Containers: []corev1.Container{container("app", "250m", "256Mi"), container("sidecar", "50m", "64Mi")},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+}
@@ -18,131 +18,252 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 
-	"github.com/robscott/kube-capacity/pkg/kube"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
 	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
-// FetchAndPrint gathers cluster resource data and outputs it
-func FetchAndPrint(showContainers, showPods, showUtil, showPodCount, availableFormat bool, podLabels, nodeLabels, namespaceLabels, namespace, kubeContext, kubeConfig, output, sortBy string) {
-	clientset, err := kube.NewClientSet(kubeContext, kubeConfig)
+// FetchAndPrint gathers cluster resource data and outputs it. In watch mode,
+// the data is gathered again and the table redrawn every interval until the
+// context is cancelled.
+func FetchAndPrint(ctx context.Context, opts Options, printOpts PrintOptions, watch bool, interval time.Duration) error {
+	printer, err := newOutputPrinter(printOpts)
 	if err != nil {
-		fmt.Printf("Error connecting to Kubernetes: %v\n", err)
-		os.Exit(1)
+		return err
 	}
+	opts.ResourceNames = printer.resourceNames(opts.ResourceNames)
+	opts.Workloads = printOpts.GroupBy == WorkloadGrouping
 
-	podList, nodeList := getPodsAndNodes(clientset, podLabels, nodeLabels, namespaceLabels, namespace)
-	var pmList *v1beta1.PodMetricsList
-	var nmList *v1beta1.NodeMetricsList
+	// Clients are created once and reused for every refresh in watch mode.
+	opts.Clientset, opts.MetricsClientset, err = opts.clientsets()
+	if err != nil {
+		return err
+	}
 
-	if showUtil {
-		mClientset, err := kube.NewMetricsClientSet(kubeContext, kubeConfig)
+	// In watch mode, pods, nodes and namespaces are kept up to date by
+	// informers rather than being listed again every interval.
+	collectFunc := func() (*ClusterCapacity, error) { return Collect(ctx, opts) }
+	if watch {
+		collector, err := newInformerCollector(opts)
 		if err != nil {
-			fmt.Printf("Error connecting to Metrics API: %v\n", err)
-			os.Exit(4)
+			return err
+		}
+		if err := collector.start(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
 		}
+		collectFunc = func() (*ClusterCapacity, error) { return collector.collect(ctx) }
+	}
 
-		pmList = getPodMetrics(mClientset, namespace)
-		if namespace == "" && namespaceLabels == "" {
-			nmList = getNodeMetrics(mClientset, nodeLabels)
+	collect := func() (*ClusterCapacity, error) {
+		cc, err := collectFunc()
+		if err != nil {
+			return nil, err
+		}
+		for _, warning := range cc.Warnings() {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", warning)
 		}
+		return cc, nil
 	}
 
-	cm := buildClusterMetric(podList, pmList, nodeList, nmList)
-	showNamespace := namespace == ""
+	if watch {
+		return watchTable(ctx, os.Stdout, os.Stderr, collect, interval, printer)
+	}
 
-	printList(&cm, showContainers, showPods, showUtil, showPodCount, showNamespace, output, sortBy, availableFormat)
+	cc, err := collect()
+	if err != nil {
+		return err
+	}
+	return printer.Print(os.Stdout, cc)
 }
 
-func getPodsAndNodes(clientset kubernetes.Interface, podLabels, nodeLabels, namespaceLabels, namespace string) (*corev1.PodList, *corev1.NodeList) {
-	nodeList, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{
-		LabelSelector: nodeLabels,
-	})
+func getPodsAndNodes(ctx context.Context, clientset kubernetes.Interface, podLabels, fieldSelector, nodeLabels, namespaceLabels, namespace string,
+	chunkSize int64) (*corev1.PodList, *corev1.NodeList, error) {
+	nodeList, err := getNodes(ctx, clientset, nodeLabels, chunkSize)
 	if err != nil {
-		fmt.Printf("Error listing Nodes: %v\n", err)
-		os.Exit(2)
+		return nil, nil, err
 	}
 
-	podList, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-		LabelSelector: podLabels,
-	})
+	podFields, err := podFieldSelector(fieldSelector, nodeList)
 	if err != nil {
-		fmt.Printf("Error listing Pods: %v\n", err)
-		os.Exit(3)
+		return nil, nil, err
 	}
 
-	newPodItems := []corev1.Pod{}
+	namespaces, err := getNamespaces(ctx, clientset, namespaceLabels, namespace, chunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	nodes := map[string]bool{}
 	for _, node := range nodeList.Items {
 		nodes[node.GetName()] = true
 	}
 
-	for _, pod := range podList.Items {
-		if !nodes[pod.Spec.NodeName] {
-			continue
+	podList := &corev1.PodList{}
+	err = eachPod(ctx, clientset, podLabels, podFields, namespace, chunkSize, func(pod *corev1.Pod) {
+		if nodes[pod.Spec.NodeName] && includeNamespace(namespaces, pod.GetNamespace()) {
+			podList.Items = append(podList.Items, *pod)
 		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-		newPodItems = append(newPodItems, pod)
+	return podList, nodeList, nil
+}
+
+func getNodes(ctx context.Context, clientset kubernetes.Interface, nodeLabels string, chunkSize int64) (*corev1.NodeList, error) {
+	nodeList := &corev1.NodeList{}
+	err := eachListItem(ctx, chunkSize, metav1.ListOptions{LabelSelector: nodeLabels},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Nodes().List(ctx, opts)
+		},
+		func(obj runtime.Object) error {
+			nodeList.Items = append(nodeList.Items, *obj.(*corev1.Node))
+			return nil
+		})
+	if err != nil {
+		return nil, &Error{Op: OpListNodes, Err: err}
 	}
 
-	podList.Items = newPodItems
+	return nodeList, nil
+}
+
+// getNamespaces returns the names of the namespaces matching namespaceLabels,
+// or nil when pods from every namespace are included.
+func getNamespaces(ctx context.Context, clientset kubernetes.Interface, namespaceLabels, namespace string, chunkSize int64) (map[string]bool, error) {
+	if namespace != "" || namespaceLabels == "" {
+		return nil, nil
+	}
 
-	if namespace == "" && namespaceLabels != "" {
-		namespaceList, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
-			LabelSelector: namespaceLabels,
+	namespaces := map[string]bool{}
+	err := eachListItem(ctx, chunkSize, metav1.ListOptions{LabelSelector: namespaceLabels},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Namespaces().List(ctx, opts)
+		},
+		func(obj runtime.Object) error {
+			namespaces[obj.(*corev1.Namespace).GetName()] = true
+			return nil
 		})
-		if err != nil {
-			fmt.Printf("Error listing Namespaces: %v\n", err)
-			os.Exit(3)
-		}
+	if err != nil {
+		return nil, &Error{Op: OpListNamespaces, Err: err}
+	}
 
-		namespaces := map[string]bool{}
-		for _, ns := range namespaceList.Items {
-			namespaces[ns.GetName()] = true
-		}
+	return namespaces, nil
+}
 
-		newPodItems := []corev1.Pod{}
+func includeNamespace(namespaces map[string]bool, namespace string) bool {
+	return namespaces == nil || namespaces[namespace]
+}
 
-		for _, pod := range podList.Items {
-			if !namespaces[pod.GetNamespace()] {
-				continue
-			}
+// podFieldSelector returns the field selector pods are listed with, so that
+// the API server leaves out completed pods and, when a single node is
+// included, pods on other nodes. Any fieldSelector given is added to it.
+func podFieldSelector(fieldSelector string, nodeList *corev1.NodeList) (string, error) {
+	selectors := []fields.Selector{
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+		fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+	}
 
-			newPodItems = append(newPodItems, pod)
+	if nodeList != nil && len(nodeList.Items) == 1 {
+		selectors = append(selectors, fields.OneTermEqualSelector("spec.nodeName", nodeList.Items[0].Name))
+	}
+
+	if fieldSelector != "" {
+		selector, err := fields.ParseSelector(fieldSelector)
+		if err != nil {
+			return "", &Error{Op: OpListPods, Err: fmt.Errorf("invalid field selector: %v", err)}
 		}
+		selectors = append(selectors, selector)
+	}
+
+	return fields.AndSelectors(selectors...).String(), nil
+}
 
-		podList.Items = newPodItems
+// eachPod calls fn with every pod matching podLabels and podFields as each
+// chunk of pods is listed, so that the full list of pods is never held at
+// once.
+func eachPod(ctx context.Context, clientset kubernetes.Interface, podLabels, podFields, namespace string, chunkSize int64, fn func(*corev1.Pod)) error {
+	err := eachListItem(ctx, chunkSize, metav1.ListOptions{LabelSelector: podLabels, FieldSelector: podFields},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return clientset.CoreV1().Pods(namespace).List(ctx, opts)
+		},
+		func(obj runtime.Object) error {
+			fn(obj.(*corev1.Pod))
+			return nil
+		})
+	if err != nil {
+		return &Error{Op: OpListPods, Err: err}
 	}
 
-	return podList, nodeList
+	return nil
 }
 
-func getPodMetrics(mClientset *metrics.Clientset, namespace string) *v1beta1.PodMetricsList {
-	pmList, err := mClientset.MetricsV1beta1().PodMetricses(namespace).List(context.TODO(), metav1.ListOptions{})
+func getPodMetrics(ctx context.Context, mClientset metrics.Interface, namespace string, chunkSize int64) (*v1beta1.PodMetricsList, error) {
+	pmList := &v1beta1.PodMetricsList{}
+	err := eachListItem(ctx, chunkSize, metav1.ListOptions{},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return mClientset.MetricsV1beta1().PodMetricses(namespace).List(ctx, opts)
+		},
+		func(obj runtime.Object) error {
+			pmList.Items = append(pmList.Items, *obj.(*v1beta1.PodMetrics))
+			return nil
+		})
 	if err != nil {
-		fmt.Printf("Error getting Pod Metrics: %v\n", err)
-		fmt.Println("For this to work, metrics-server needs to be running in your cluster")
-		os.Exit(6)
+		return nil, &Error{Op: OpPodMetrics, Err: err}
 	}
 
-	return pmList
+	return pmList, nil
 }
 
-func getNodeMetrics(mClientset *metrics.Clientset, nodeLabels string) *v1beta1.NodeMetricsList {
-	nmList, err := mClientset.MetricsV1beta1().NodeMetricses().List(context.TODO(), metav1.ListOptions{
-		LabelSelector: nodeLabels,
-	})
+func getNodeMetrics(ctx context.Context, mClientset metrics.Interface, nodeLabels string, chunkSize int64) (*v1beta1.NodeMetricsList, error) {
+	nmList := &v1beta1.NodeMetricsList{}
+	err := eachListItem(ctx, chunkSize, metav1.ListOptions{LabelSelector: nodeLabels},
+		func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return mClientset.MetricsV1beta1().NodeMetricses().List(ctx, opts)
+		},
+		func(obj runtime.Object) error {
+			nmList.Items = append(nmList.Items, *obj.(*v1beta1.NodeMetrics))
+			return nil
+		})
 	if err != nil {
-		fmt.Printf("Error getting Node Metrics: %v\n", err)
-		fmt.Println("For this to work, metrics-server needs to be running in your cluster")
-		os.Exit(7)
+		return nil, &Error{Op: OpNodeMetrics, Err: err}
 	}
 
-	return nmList
+	return nmList, nil
+}
+
+// eachListItem lists objects at most chunkSize at a time, following continue
+// tokens like kubectl does, and calls fn with each item. Every chunk is a
+// separate request bounded by the request timeout. A chunkSize of 0 lists
+// everything in a single request.
+func eachListItem(ctx context.Context, chunkSize int64, opts metav1.ListOptions,
+	list func(context.Context, metav1.ListOptions) (runtime.Object, error), fn func(runtime.Object) error) error {
+	p := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		reqCtx, cancel := requestContext(ctx)
+		defer cancel()
+		return list(reqCtx, opts)
+	})
+	p.PageSize = chunkSize
+
+	return p.EachListItem(ctx, opts, fn)
+}
+
+func containsResource(resourceNames []string, resourceName string) bool {
+	for _, name := range resourceNames {
+		if name == resourceName {
+			return true
+		}
+	}
+	return false
 }
@@ -15,11 +15,15 @@
 package capacity
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -40,7 +44,8 @@ func TestGetPodsAndNodes(t *testing.T) {
 		pod("mynode", "default", "mypod6", map[string]string{"g": "test"}),
 	)
 
-	podList, nodeList := getPodsAndNodes(clientset, "", "", "", "")
+	podList, nodeList, err := getPodsAndNodes(context.TODO(), clientset, "", "", "", "", "", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode", "mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"another/mypod5",
@@ -52,7 +57,8 @@ func TestGetPodsAndNodes(t *testing.T) {
 		"other/mypod3",
 	}, listPods(podList))
 
-	podList, nodeList = getPodsAndNodes(clientset, "", "hello=world", "", "")
+	podList, nodeList, err = getPodsAndNodes(context.TODO(), clientset, "", "", "hello=world", "", "", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode", "mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"another/mypod5",
@@ -64,7 +70,8 @@ func TestGetPodsAndNodes(t *testing.T) {
 		"other/mypod3",
 	}, listPods(podList))
 
-	podList, nodeList = getPodsAndNodes(clientset, "", "moon=lol", "", "")
+	podList, nodeList, err = getPodsAndNodes(context.TODO(), clientset, "", "", "moon=lol", "", "", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"default/mypod4",
@@ -72,25 +79,96 @@ func TestGetPodsAndNodes(t *testing.T) {
 		"other/mypod3",
 	}, listPods(podList))
 
-	podList, nodeList = getPodsAndNodes(clientset, "a=test", "", "", "")
+	podList, nodeList, err = getPodsAndNodes(context.TODO(), clientset, "a=test", "", "", "", "", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode", "mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"default/mypod",
 	}, listPods(podList))
 
-	podList, nodeList = getPodsAndNodes(clientset, "a=test,b!=test", "", "app=true", "")
+	podList, nodeList, err = getPodsAndNodes(context.TODO(), clientset, "a=test,b!=test", "", "", "app=true", "", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode", "mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"default/mypod",
 	}, listPods(podList))
 
-	podList, nodeList = getPodsAndNodes(clientset, "a=test,b!=test", "", "", "default")
+	podList, nodeList, err = getPodsAndNodes(context.TODO(), clientset, "a=test,b!=test", "", "", "", "default", 500)
+	assert.NoError(t, err)
 	assert.Equal(t, []string{"mynode", "mynode2"}, listNodes(nodeList))
 	assert.Equal(t, []string{
 		"default/mypod",
 	}, listPods(podList))
 }
 
+func TestPodFieldSelector(t *testing.T) {
+	twoNodes := &corev1.NodeList{Items: []corev1.Node{*node("mynode", nil), *node("mynode2", nil)}}
+	oneNode := &corev1.NodeList{Items: []corev1.Node{*node("mynode", nil)}}
+
+	selector, err := podFieldSelector("", twoNodes)
+	assert.NoError(t, err)
+	assert.Equal(t, "status.phase!=Succeeded,status.phase!=Failed", selector)
+
+	selector, err = podFieldSelector("", oneNode)
+	assert.NoError(t, err)
+	assert.Equal(t, "status.phase!=Succeeded,status.phase!=Failed,spec.nodeName=mynode", selector)
+
+	selector, err = podFieldSelector("spec.schedulerName=default-scheduler", twoNodes)
+	assert.NoError(t, err)
+	assert.Equal(t, "status.phase!=Succeeded,status.phase!=Failed,spec.schedulerName=default-scheduler", selector)
+
+	_, err = podFieldSelector("spec.nodeName", twoNodes)
+	assert.Error(t, err)
+}
+
+func TestEachListItemChunks(t *testing.T) {
+	pods := []corev1.Pod{}
+	for i := 0; i < 5; i++ {
+		pods = append(pods, *pod("mynode", "default", fmt.Sprintf("mypod%d", i), nil))
+	}
+
+	// Like the API server, return at most Limit pods with the offset of the
+	// next chunk as the continue token.
+	var limits []int64
+	list := func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		limits = append(limits, opts.Limit)
+
+		start := 0
+		if opts.Continue != "" {
+			start, _ = strconv.Atoi(opts.Continue)
+		}
+		end := len(pods)
+		if opts.Limit > 0 && start+int(opts.Limit) < end {
+			end = start + int(opts.Limit)
+		}
+
+		podList := &corev1.PodList{Items: pods[start:end]}
+		if end < len(pods) {
+			podList.Continue = strconv.Itoa(end)
+		}
+		return podList, nil
+	}
+
+	names := []string{}
+	err := eachListItem(context.TODO(), 2, metav1.ListOptions{}, list, func(obj runtime.Object) error {
+		names = append(names, obj.(*corev1.Pod).Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mypod0", "mypod1", "mypod2", "mypod3", "mypod4"}, names)
+	assert.Equal(t, []int64{2, 2, 2}, limits)
+
+	limits = nil
+	names = []string{}
+	err = eachListItem(context.TODO(), 0, metav1.ListOptions{}, list, func(obj runtime.Object) error {
+		names = append(names, obj.(*corev1.Pod).Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, names, 5)
+	assert.Equal(t, []int64{0}, limits)
+}
+
 func node(name string, labels map[string]string) *corev1.Node {
 	return &corev1.Node{
 		TypeMeta: metav1.TypeMeta{
@@ -0,0 +1,272 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
+	"github.com/robscott/kube-capacity/pkg/kube"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// Options configures what Collect gathers from a cluster.
+type Options struct {
+	// Clientset is used to talk to the cluster. When nil, a clientset is
+	// created from KubeContext and KubeConfig.
+	Clientset kubernetes.Interface
+	// MetricsClientset is used to get utilization. When nil and Utilization
+	// is set, a clientset is created from KubeContext and KubeConfig.
+	MetricsClientset metrics.Interface
+	KubeContext      string
+	KubeConfig       string
+
+	PodLabels       string
+	NodeLabels      string
+	NamespaceLabels string
+	Namespace       string
+	// FieldSelector filters pods on fields like spec.nodeName. Completed
+	// pods are always left out.
+	FieldSelector string
+	// Pending adds pods that are not scheduled on a node yet to a pending
+	// pseudo node, rather than leaving them out.
+	Pending bool
+
+	// ResourceNames defaults to DefaultResources.
+	ResourceNames []string
+	// Utilization gets utilization from the Metrics API.
+	Utilization bool
+	// Workloads looks up the workload owning each pod, which grouping by
+	// workload requires.
+	Workloads bool
+	// RequestTimeout bounds each request to the API server. Zero means no
+	// timeout.
+	RequestTimeout time.Duration
+	// ChunkSize limits how many objects are returned by each list request,
+	// with large lists retrieved in chunks. Zero lists everything in a
+	// single request.
+	ChunkSize int64
+}
+
+// ClusterCapacity is the capacity of a cluster gathered by Collect, ready to
+// be printed by a Printer.
+type ClusterCapacity struct {
+	options  Options
+	cm       clusterMetric
+	warnings []error
+}
+
+// Warnings returns the problems that were worked around while collecting,
+// such as utilization being left out because the Metrics API timed out.
+func (cc *ClusterCapacity) Warnings() []error {
+	return cc.warnings
+}
+
+// Collect gathers the requests, limits and optionally utilization of the pods
+// and nodes in a cluster. Errors are of type *Error and match
+// ErrMetricsUnavailable and ErrForbidden with errors.Is. If getting
+// utilization times out, the capacity is returned without it and with a
+// warning.
+func Collect(ctx context.Context, opts Options) (*ClusterCapacity, error) {
+	ctx = withRequestTimeout(ctx, opts.RequestTimeout)
+
+	if len(opts.ResourceNames) == 0 {
+		opts.ResourceNames = DefaultResources
+	}
+
+	clientset, mClientset, err := opts.clientsets()
+	if err != nil {
+		return nil, err
+	}
+
+	nodeList, err := getNodes(ctx, clientset, opts.NodeLabels, opts.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := getNamespaces(ctx, clientset, opts.NamespaceLabels, opts.Namespace, opts.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limiting pods to a single node would leave out unscheduled pods.
+	selectorNodes := nodeList
+	if opts.Pending {
+		selectorNodes = nil
+	}
+	podFields, err := podFieldSelector(opts.FieldSelector, selectorNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &ClusterCapacity{options: opts}
+	cc.cm = newClusterMetric(nodeList, nil, opts.ResourceNames)
+	if opts.Pending {
+		cc.cm.addPending()
+	}
+
+	var pmList *v1beta1.PodMetricsList
+	var nmList *v1beta1.NodeMetricsList
+
+	if opts.Utilization {
+		pmList, nmList, err = cc.getUtilization(ctx, clientset, mClientset, isTimeout)
+		if err != nil {
+			return nil, err
+		}
+		cc.cm.addNodeUtilization(nmList)
+	}
+
+	// Pods are added as each chunk is listed rather than being held in a
+	// single list, which matters on clusters with a large number of pods.
+	podMetrics := indexPodMetrics(pmList)
+	err = eachPod(ctx, clientset, opts.PodLabels, podFields, opts.Namespace, opts.ChunkSize, func(pod *corev1.Pod) {
+		if includeNamespace(namespaces, pod.GetNamespace()) {
+			cc.cm.addPod(pod, podMetrics)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	cc.cm.addNodeMetrics(nmList == nil)
+
+	if opts.Workloads {
+		workloads, warnings := getPodWorkloads(ctx, clientset, &cc.cm, opts.Namespace, opts.ChunkSize)
+		cc.warnings = append(cc.warnings, warnings...)
+		cc.cm.addWorkloads(workloads)
+	}
+
+	return cc, nil
+}
+
+// clientsets returns the clientsets given in the options, creating any that
+// are needed but missing.
+func (opts Options) clientsets() (kubernetes.Interface, metrics.Interface, error) {
+	clientset := opts.Clientset
+	if clientset == nil {
+		cs, err := kube.NewClientSet(opts.KubeContext, opts.KubeConfig)
+		if err != nil {
+			return nil, nil, &Error{Op: OpConnect, Err: err}
+		}
+		clientset = cs
+	}
+
+	mClientset := opts.MetricsClientset
+	if opts.Utilization && mClientset == nil {
+		mcs, err := kube.NewMetricsClientSet(opts.KubeContext, opts.KubeConfig)
+		if err != nil {
+			return nil, nil, &Error{Op: OpConnectMetrics, Err: err}
+		}
+		mClientset = mcs
+	}
+
+	return clientset, mClientset, nil
+}
+
+// getUtilization gets utilization for the nodes already in the cluster
+// metric. Errors that tolerate returns true for are recorded as a warning and
+// the capacity is left without utilization.
+func (cc *ClusterCapacity) getUtilization(ctx context.Context, clientset kubernetes.Interface, mClientset metrics.Interface,
+	tolerate func(error) bool) (*v1beta1.PodMetricsList, *v1beta1.NodeMetricsList, error) {
+	opts := cc.options
+	pmList, nmList, err := getMetrics(ctx, mClientset, opts.NodeLabels, opts.NamespaceLabels, opts.Namespace, opts.ChunkSize)
+	if err != nil {
+		if !tolerate(err) {
+			return nil, nil, err
+		}
+		cc.warnings = append(cc.warnings, fmt.Errorf("%v, showing capacity without utilization", err))
+		cc.options.Utilization = false
+		return nil, nil, nil
+	}
+
+	if containsResource(opts.ResourceNames, string(corev1.ResourceEphemeralStorage)) {
+		nodeNames := []string{}
+		for name := range cc.cm.nodeMetrics {
+			nodeNames = append(nodeNames, name)
+		}
+		sort.Strings(nodeNames)
+		var warnings []error
+		cc.cm.podStorage, warnings = addEphemeralStorageMetrics(ctx, clientset, nodeNames, pmList, nmList)
+		cc.warnings = append(cc.warnings, warnings...)
+	}
+
+	return pmList, nmList, nil
+}
+
+// getMetrics gets pod utilization and, when all pods are included, node
+// utilization.
+func getMetrics(ctx context.Context, mClientset metrics.Interface, nodeLabels, namespaceLabels, namespace string,
+	chunkSize int64) (*v1beta1.PodMetricsList, *v1beta1.NodeMetricsList, error) {
+	pmList, err := getPodMetrics(ctx, mClientset, namespace, chunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if namespace != "" || namespaceLabels != "" {
+		return pmList, nil, nil
+	}
+
+	nmList, err := getNodeMetrics(ctx, mClientset, nodeLabels, chunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pmList, nmList, nil
+}
+
+type requestTimeoutKey struct{}
+
+// withRequestTimeout returns a context that bounds each request made with
+// it, through requestContext, by the timeout.
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// requestContext returns the context for a single request to the API server.
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// isTimeout returns true if a request timed out, either locally or on the
+// server, rather than failing or being cancelled.
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err)
+}
+
+// ClusterMetrics returns the capacity of every node, pod and container in the
+// v2 output format, with numeric values and pod overhead.
+func (cc *ClusterCapacity) ClusterMetrics() *apiv2.ClusterMetrics {
+	lp := &listPrinter{
+		cm:             &cc.cm,
+		showPods:       true,
+		showContainers: true,
+		showUtil:       cc.options.Utilization,
+		showOverhead:   true,
+		showPodCount:   true,
+		sortBy:         "name",
+	}
+	lcm := lp.buildListClusterMetricsV2()
+	return &lcm
+}
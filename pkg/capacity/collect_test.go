@@ -0,0 +1,246 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func TestCollect(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+
+	// The fake tracker does not map PodMetrics to the pods resource the
+	// Metrics API serves them as, so the list is returned by a reactor.
+	mClientset := metricsfake.NewSimpleClientset()
+	mClientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &v1beta1.PodMetricsList{Items: []v1beta1.PodMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Containers: []v1beta1.ContainerMetrics{{
+				Name:  "web",
+				Usage: corev1.ResourceList{"cpu": resource.MustParse("150m"), "memory": resource.MustParse("64Mi")},
+			}},
+		}}}, nil
+	})
+
+	cc, err := Collect(context.TODO(), Options{
+		Clientset:        fake.NewSimpleClientset(&node1, &web),
+		MetricsClientset: mClientset,
+		Namespace:        "default",
+		Utilization:      true,
+	})
+	assert.NoError(t, err)
+
+	lcm := cc.ClusterMetrics()
+	assert.Len(t, lcm.Nodes, 1)
+	assert.Equal(t, "web", lcm.Nodes[0].Pods[0].Name)
+	assert.Equal(t, int64(200), lcm.ClusterTotals.Resources["cpu"].Requests)
+	assert.Equal(t, int64(150), *lcm.Nodes[0].Pods[0].Resources["cpu"].Utilization)
+	assert.Equal(t, int64(1000), lcm.ClusterTotals.Resources["cpu"].Allocatable)
+}
+
+func TestCollectFieldSelector(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+
+	clientset := fake.NewSimpleClientset(&node1, &web)
+	var podFields string
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		podFields = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		return false, nil, nil
+	})
+
+	cc, err := Collect(context.TODO(), Options{
+		Clientset:     clientset,
+		FieldSelector: "spec.schedulerName=default-scheduler",
+	})
+	assert.NoError(t, err)
+	// The fake clientset parses the selector, which sorts its terms.
+	assert.Equal(t, "spec.nodeName=example-node-1,spec.schedulerName=default-scheduler,status.phase!=Failed,status.phase!=Succeeded", podFields)
+	assert.Len(t, cc.ClusterMetrics().Nodes[0].Pods, 1)
+}
+
+func TestCollectPending(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	queued := pendingTestPod("default", "queued", "300m", time.Now().Add(-5*time.Minute))
+
+	clientset := fake.NewSimpleClientset(&node1, &web, &queued)
+	var podFields string
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		podFields = action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		return false, nil, nil
+	})
+
+	cc, err := Collect(context.TODO(), Options{Clientset: clientset})
+	assert.NoError(t, err)
+	assert.Nil(t, cc.ClusterMetrics().Pending)
+
+	cc, err = Collect(context.TODO(), Options{Clientset: clientset, Pending: true})
+	assert.NoError(t, err)
+	// Pods are not limited to the only node, which would leave out pending
+	// pods.
+	assert.Equal(t, "status.phase!=Failed,status.phase!=Succeeded", podFields)
+
+	lcm := cc.ClusterMetrics()
+	assert.Equal(t, int64(200), lcm.ClusterTotals.Resources["cpu"].Requests)
+	assert.Equal(t, int64(1), lcm.ClusterTotals.PodCount.Current)
+
+	assert.Equal(t, int64(300), lcm.Pending.Resources["cpu"].Requests)
+	assert.Equal(t, int64(1000), lcm.Pending.Resources["cpu"].Allocatable)
+	assert.Equal(t, float64(30), lcm.Pending.Resources["cpu"].RequestsPercent)
+	assert.Equal(t, &apiv2.PodCount{Current: 1, Allocatable: 110}, lcm.Pending.PodCount)
+	assert.Len(t, lcm.Pending.Pods, 1)
+	assert.Equal(t, "queued", lcm.Pending.Pods[0].Name)
+	assert.Equal(t, "Unschedulable", lcm.Pending.Pods[0].Reason)
+	assert.Equal(t, "0/1 nodes are available: 1 Insufficient cpu.", lcm.Pending.Pods[0].Message)
+	assert.GreaterOrEqual(t, lcm.Pending.Pods[0].AgeSeconds, int64(300))
+}
+
+func TestCollectErrors(t *testing.T) {
+	forbidden := func(resource string) k8stesting.ReactionFunc {
+		return func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: resource}, "", errors.New("no access"))
+		}
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", forbidden("pods"))
+
+	_, err := Collect(context.TODO(), Options{Clientset: clientset})
+	var capacityErr *Error
+	assert.True(t, errors.As(err, &capacityErr))
+	assert.Equal(t, OpListPods, capacityErr.Op)
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.False(t, errors.Is(err, ErrMetricsUnavailable))
+
+	mClientset := metricsfake.NewSimpleClientset()
+	mClientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("metrics-server is not running")
+	})
+
+	_, err = Collect(context.TODO(), Options{
+		Clientset:        fake.NewSimpleClientset(),
+		MetricsClientset: mClientset,
+		Utilization:      true,
+	})
+	assert.True(t, errors.As(err, &capacityErr))
+	assert.Equal(t, OpPodMetrics, capacityErr.Op)
+	assert.True(t, errors.Is(err, ErrMetricsUnavailable))
+	assert.False(t, errors.Is(err, ErrForbidden))
+	assert.Equal(t, "Error getting Pod Metrics: metrics-server is not running", err.Error())
+}
+
+func TestPrinter(t *testing.T) {
+	cc := &ClusterCapacity{cm: getTestGroupClusterMetric()}
+
+	printer, err := NewPrinter(PrintOptions{Output: CSVOutput})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, printer.Print(&buf, cc))
+	assert.Contains(t, buf.String(), "node,example-node-1,,,,500,800,1000,")
+
+	printer, err = NewPrinter(PrintOptions{})
+	assert.NoError(t, err)
+
+	buf.Reset()
+	assert.NoError(t, printer.Print(&buf, cc))
+	assert.Contains(t, buf.String(), "NODE")
+
+	printer, err = NewPrinter(PrintOptions{GroupBy: WorkloadGrouping})
+	assert.NoError(t, err)
+	assert.Error(t, printer.Print(&buf, cc))
+
+	_, err = NewPrinter(PrintOptions{Output: "xml"})
+	assert.Error(t, err)
+
+	_, err = NewPrinter(PrintOptions{Output: "custom-columns=NODE"})
+	assert.Error(t, err)
+}
+
+func TestCollectMetricsTimeout(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+
+	mClientset := metricsfake.NewSimpleClientset()
+	mClientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewTimeoutError("metrics-server did not respond", 0)
+	})
+
+	cc, err := Collect(context.TODO(), Options{
+		Clientset:        fake.NewSimpleClientset(&node1, &web),
+		MetricsClientset: mClientset,
+		Utilization:      true,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, cc.Warnings(), 1)
+	assert.Contains(t, cc.Warnings()[0].Error(), "showing capacity without utilization")
+	assert.Equal(t, int64(200), cc.ClusterMetrics().ClusterTotals.Resources["cpu"].Requests)
+	assert.Nil(t, cc.ClusterMetrics().ClusterTotals.Resources["cpu"].Utilization)
+
+	printer, err := NewPrinter(PrintOptions{ShowUtil: true})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, printer.Print(&buf, cc))
+	assert.NotContains(t, buf.String(), "CPU UTIL")
+}
+
+func TestRequestContext(t *testing.T) {
+	ctx, cancel := requestContext(withRequestTimeout(context.TODO(), time.Millisecond))
+	defer cancel()
+	<-ctx.Done()
+	assert.True(t, isTimeout(ctx.Err()))
+
+	ctx, cancel = requestContext(context.TODO())
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	cancel()
+	assert.False(t, isTimeout(ctx.Err()))
+}
+
+// pendingTestPod returns a pod the scheduler could not find a node for.
+func pendingTestPod(namespace, name, cpuRequest string, created time.Time) corev1.Pod {
+	pod := groupTestPod("", namespace, name, cpuRequest, cpuRequest)
+	pod.CreationTimestamp = metav1.NewTime(created)
+	pod.Status = corev1.PodStatus{
+		Phase: corev1.PodPending,
+		Conditions: []corev1.PodCondition{{
+			Type:    corev1.PodScheduled,
+			Status:  corev1.ConditionFalse,
+			Reason:  corev1.PodReasonUnschedulable,
+			Message: "0/1 nodes are available: 1 Insufficient cpu.",
+		}},
+	}
+	return pod
+}
@@ -0,0 +1,336 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	//CustomColumnsOutput is the prefix of custom-columns=<spec> output types
+	CustomColumnsOutput string = "custom-columns"
+	//CustomColumnsFileOutput is the prefix of custom-columns-file=<file> output types
+	CustomColumnsFileOutput string = "custom-columns-file"
+)
+
+// customColumnFields are the fields describing what a row is about.
+var customColumnFields = []string{"node", "namespace", "pod", "container", "containerType", "pods"}
+
+// customColumnMetrics are the fields available for each resource, named like
+// the JSON output, as in cpu.requests or memory.utilizationPercent.
+var customColumnMetrics = []string{
+	"requests", "limits", "utilization", "allocatable",
+	"requestsPercent", "limitsPercent", "utilizationPercent",
+}
+
+const (
+	labelsFieldPrefix     = "labels."
+	nodeLabelsFieldPrefix = "nodeLabels."
+)
+
+type customColumn struct {
+	header string
+	field  string
+}
+
+// customColumnsPrinter outputs a table with user defined columns, with a row
+// for the cluster, each node and optionally each pod and container.
+type customColumnsPrinter struct {
+	cm             *clusterMetric
+	columns        []*customColumn
+	showPods       bool
+	showContainers bool
+	sortBy         string
+}
+
+// customRow holds everything a custom column can refer to for a row.
+type customRow struct {
+	node          string
+	namespace     string
+	pod           string
+	container     string
+	containerType string
+	labels        map[string]string
+	nodeLabels    map[string]string
+	resources     resourceMetrics
+	podCount      *podCount
+}
+
+// parseCustomColumnsOutput parses the columns of a custom-columns or
+// custom-columns-file output type.
+func parseCustomColumnsOutput(format, arg string) ([]*customColumn, error) {
+	if format != CustomColumnsFileOutput {
+		return parseCustomColumns(arg)
+	}
+
+	raw, err := os.ReadFile(arg)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading custom columns file: %v", err)
+	}
+	return parseCustomColumnsFile(string(raw))
+}
+
+// parseCustomColumns parses a comma separated list of HEADER:field columns.
+func parseCustomColumns(spec string) ([]*customColumn, error) {
+	columns := []*customColumn{}
+
+	for _, part := range strings.Split(spec, ",") {
+		header, field, found := strings.Cut(part, ":")
+		if !found || header == "" || field == "" {
+			return nil, fmt.Errorf("Invalid custom column %q, expected HEADER:field", part)
+		}
+
+		if err := validateCustomColumnField(field); err != nil {
+			return nil, err
+		}
+		columns = append(columns, &customColumn{header: header, field: field})
+	}
+
+	return columns, nil
+}
+
+// parseCustomColumnsFile parses a file with headers on the first line and the
+// matching fields on the second, separated by whitespace like kubectl does.
+func parseCustomColumnsFile(contents string) ([]*customColumn, error) {
+	lines := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("Custom columns file must have a line of headers and a line of fields")
+	}
+
+	headers := strings.Fields(lines[0])
+	fields := strings.Fields(lines[1])
+	if len(headers) != len(fields) {
+		return nil, fmt.Errorf("Custom columns file has %d headers but %d fields", len(headers), len(fields))
+	}
+
+	columns := []*customColumn{}
+	for i := range headers {
+		if err := validateCustomColumnField(fields[i]); err != nil {
+			return nil, err
+		}
+		columns = append(columns, &customColumn{header: headers[i], field: fields[i]})
+	}
+
+	return columns, nil
+}
+
+func validateCustomColumnField(field string) error {
+	for _, prefix := range []string{labelsFieldPrefix, nodeLabelsFieldPrefix} {
+		if strings.HasPrefix(field, prefix) && len(field) > len(prefix) {
+			return nil
+		}
+	}
+
+	if containsResource(customColumnFields, field) {
+		return nil
+	}
+
+	if resourceName, metric := splitResourceField(field); resourceName != "" && containsResource(customColumnMetrics, metric) {
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported custom column field %q, expected one of %v, a resource followed by one of %v, "+
+		"or a label key prefixed with %q or %q", field, customColumnFields, customColumnMetrics, labelsFieldPrefix, nodeLabelsFieldPrefix)
+}
+
+// splitResourceField splits fields like nvidia.com/gpu.requests on the last
+// dot, as resource names can contain dots.
+func splitResourceField(field string) (resourceName, metric string) {
+	i := strings.LastIndex(field, ".")
+	if i < 0 {
+		return "", field
+	}
+	return field[:i], field[i+1:]
+}
+
+// customColumnsResourceNames adds the resources referred to by custom columns
+// to the resources to include.
+func customColumnsResourceNames(resourceNames []string, columns []*customColumn) []string {
+	names := append([]string{}, resourceNames...)
+	for _, column := range columns {
+		if strings.HasPrefix(column.field, labelsFieldPrefix) || strings.HasPrefix(column.field, nodeLabelsFieldPrefix) {
+			continue
+		}
+		if resourceName, _ := splitResourceField(column.field); resourceName != "" && !containsResource(names, resourceName) {
+			names = append(names, resourceName)
+		}
+	}
+	return names
+}
+
+func (cp *customColumnsPrinter) Print(out io.Writer) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+
+	for _, line := range cp.getLines() {
+		fmt.Fprintln(w, strings.Join(line, "\t "))
+	}
+
+	return w.Flush()
+}
+
+func (cp *customColumnsPrinter) getLines() [][]string {
+	headers := []string{}
+	for _, column := range cp.columns {
+		headers = append(headers, column.header)
+	}
+	lines := [][]string{headers}
+
+	for _, row := range cp.rows() {
+		line := []string{}
+		for _, column := range cp.columns {
+			line = append(line, row.value(column.field))
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func (cp *customColumnsPrinter) rows() []*customRow {
+	rows := []*customRow{}
+	sortedNodeMetrics := cp.cm.getSortedNodeMetrics(cp.sortBy)
+
+	if len(sortedNodeMetrics) > 1 {
+		rows = append(rows, &customRow{
+			node:      "*",
+			namespace: "*",
+			pod:       "*",
+			container: "*",
+			resources: cp.cm.resources,
+			podCount:  cp.cm.podCount,
+		})
+	}
+
+	for _, nm := range sortedNodeMetrics {
+		rows = append(rows, &customRow{
+			node:       nm.name,
+			namespace:  "*",
+			pod:        "*",
+			container:  "*",
+			labels:     nm.labels,
+			nodeLabels: nm.labels,
+			resources:  nm.resources,
+			podCount:   nm.podCount,
+		})
+
+		if !cp.showPods && !cp.showContainers {
+			continue
+		}
+
+		for _, pm := range nm.getSortedPodMetrics(cp.sortBy) {
+			podRow := &customRow{
+				node:       nm.name,
+				namespace:  pm.namespace,
+				pod:        pm.name,
+				container:  "*",
+				labels:     pm.labels,
+				nodeLabels: nm.labels,
+				resources:  pm.resources,
+			}
+			rows = append(rows, podRow)
+
+			if !cp.showContainers {
+				continue
+			}
+
+			for _, ctm := range pm.getSortedContainerMetrics(cp.sortBy) {
+				containerRow := *podRow
+				containerRow.container = ctm.name
+				containerRow.containerType = ctm.containerType
+				containerRow.resources = ctm.resources
+				rows = append(rows, &containerRow)
+			}
+		}
+	}
+
+	return rows
+}
+
+// value returns the value of a field for the row, or <none> for labels the
+// row does not have.
+func (cr *customRow) value(field string) string {
+	switch field {
+	case "node":
+		return cr.node
+	case "namespace":
+		return cr.namespace
+	case "pod":
+		return cr.pod
+	case "container":
+		return cr.container
+	case "containerType":
+		return cr.containerType
+	case "pods":
+		if cr.podCount == nil {
+			return ""
+		}
+		return cr.podCount.podCountString()
+	}
+
+	if strings.HasPrefix(field, labelsFieldPrefix) {
+		return labelValue(cr.labels, strings.TrimPrefix(field, labelsFieldPrefix))
+	}
+	if strings.HasPrefix(field, nodeLabelsFieldPrefix) {
+		return labelValue(cr.nodeLabels, strings.TrimPrefix(field, nodeLabelsFieldPrefix))
+	}
+
+	resourceName, metric := splitResourceField(field)
+	rm, ok := cr.resources[resourceName]
+	if !ok {
+		return ""
+	}
+
+	switch metric {
+	case "requests":
+		return formatQuantity(resourceName, rm.request)
+	case "limits":
+		return formatQuantity(resourceName, rm.limit)
+	case "utilization":
+		return formatQuantity(resourceName, rm.utilization)
+	case "allocatable":
+		return formatQuantity(resourceName, rm.allocatable)
+	case "requestsPercent":
+		return percentString(rm, rm.request)
+	case "limitsPercent":
+		return percentString(rm, rm.limit)
+	case "utilizationPercent":
+		return percentString(rm, rm.utilization)
+	}
+
+	return ""
+}
+
+func labelValue(labels map[string]string, key string) string {
+	if value, ok := labels[key]; ok {
+		return value
+	}
+	return "<none>"
+}
+
+func percentString(rm *resourceMetric, q resource.Quantity) string {
+	return fmt.Sprintf("%d%%", rm.percent(q))
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseCustomColumns(t *testing.T) {
+	columns, err := parseCustomColumns("NODE:node,GPU_REQ:nvidia.com/gpu.requests,ZONE:labels.topology.kubernetes.io/zone")
+	assert.NoError(t, err)
+	assert.Equal(t, []*customColumn{
+		{header: "NODE", field: "node"},
+		{header: "GPU_REQ", field: "nvidia.com/gpu.requests"},
+		{header: "ZONE", field: "labels.topology.kubernetes.io/zone"},
+	}, columns)
+	assert.Equal(t, []string{"cpu", "memory", "nvidia.com/gpu"}, customColumnsResourceNames(DefaultResources, columns))
+
+	for _, spec := range []string{"NODE", "NODE:", ":node", "CPU:cpu.requestz", "NAME:name", "L:labels."} {
+		_, err := parseCustomColumns(spec)
+		assert.Error(t, err, spec)
+	}
+
+	columns, err = parseCustomColumnsFile("NODE   CPU_REQ\nnode   cpu.requests\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []*customColumn{
+		{header: "NODE", field: "node"},
+		{header: "CPU_REQ", field: "cpu.requests"},
+	}, columns)
+
+	_, err = parseCustomColumnsFile("NODE CPU_REQ\nnode\n")
+	assert.Error(t, err)
+}
+
+func TestCustomColumnsPrinter(t *testing.T) {
+	zoneA := groupTestNode("example-node-1")
+	zoneA.Labels = map[string]string{"topology.kubernetes.io/zone": "zone-a"}
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	web.Labels = map[string]string{"app": "web"}
+
+	cm := buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				web,
+				groupTestPod("example-node-2", "default", "api", "300m", "300m"),
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{zoneA, groupTestNode("example-node-2")},
+		}, nil, DefaultResources,
+	)
+
+	columns, err := parseCustomColumns("NODE:node,POD:pod,CPU_REQ:cpu.requests,CPU_LIM%:cpu.limitsPercent," +
+		"MEM:memory.allocatable,ZONE:nodeLabels.topology.kubernetes.io/zone,APP:labels.app,PODS:pods")
+	assert.NoError(t, err)
+
+	cp := &customColumnsPrinter{
+		cm:       &cm,
+		columns:  columns,
+		showPods: true,
+		sortBy:   "name",
+	}
+
+	assert.Equal(t, [][]string{
+		{"NODE", "POD", "CPU_REQ", "CPU_LIM%", "MEM", "ZONE", "APP", "PODS"},
+		{"*", "*", "500m", "35%", "8000Mi", "<none>", "<none>", "2/220"},
+		{"example-node-1", "*", "200m", "40%", "4000Mi", "zone-a", "<none>", "1/110"},
+		{"example-node-1", "web", "200m", "40%", "4000Mi", "zone-a", "web", ""},
+		{"example-node-2", "*", "300m", "30%", "4000Mi", "<none>", "<none>", "1/110"},
+		{"example-node-2", "api", "300m", "30%", "4000Mi", "<none>", "<none>", ""},
+	}, cp.getLines())
+}
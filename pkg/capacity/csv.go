@@ -0,0 +1,130 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// csvPrinter outputs one flat row per cluster, node, pod and container with
+// raw numeric values that are easy to work with in spreadsheets.
+type csvPrinter struct {
+	cm             *clusterMetric
+	showPods       bool
+	showContainers bool
+	showUtil       bool
+	showPodCount   bool
+	sortBy         string
+	separator      rune
+}
+
+func (cp *csvPrinter) Print(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Comma = cp.separator
+
+	return w.WriteAll(cp.rows())
+}
+
+func (cp *csvPrinter) rows() [][]string {
+	rows := [][]string{cp.headerRow()}
+
+	rows = append(rows, cp.row("cluster", "", "", "", "", "", cp.cm.resources, cp.cm.podCount))
+
+	for _, nm := range cp.cm.getSortedNodeMetrics(cp.sortBy) {
+		rows = append(rows, cp.row("node", nm.name, "", "", "", "", nm.resources, nm.podCount))
+
+		if !cp.showPods && !cp.showContainers {
+			continue
+		}
+
+		for _, pm := range nm.getSortedPodMetrics(cp.sortBy) {
+			rows = append(rows, cp.row("pod", nm.name, pm.namespace, pm.name, "", "", pm.resources, nil))
+
+			if !cp.showContainers {
+				continue
+			}
+
+			for _, ctm := range pm.getSortedContainerMetrics(cp.sortBy) {
+				rows = append(rows, cp.row("container", nm.name, pm.namespace, pm.name, ctm.name, ctm.containerType, ctm.resources, nil))
+			}
+		}
+	}
+
+	return rows
+}
+
+func (cp *csvPrinter) headerRow() []string {
+	row := []string{"level", "node", "namespace", "pod", "container"}
+	if cp.showContainers {
+		row = append(row, "container_type")
+	}
+
+	for _, name := range cp.cm.resourceNames {
+		metrics := []string{"requests", "limits"}
+		if cp.showUtil {
+			metrics = append(metrics, "util")
+		}
+		metrics = append(metrics, "allocatable")
+
+		for _, metric := range metrics {
+			column := name + "_" + metric
+			if unit := rawUnit(name); unit != "" {
+				column += "_" + unit
+			}
+			row = append(row, column)
+		}
+	}
+
+	if cp.showPodCount {
+		row = append(row, "pods", "pods_allocatable")
+	}
+
+	return row
+}
+
+func (cp *csvPrinter) row(level, node, namespace, pod, container, containerType string, rms resourceMetrics, pc *podCount) []string {
+	row := []string{level, node, namespace, pod, container}
+	if cp.showContainers {
+		row = append(row, containerType)
+	}
+
+	for _, name := range cp.cm.resourceNames {
+		rm := rms[name]
+		row = append(row, rawString(name, rm.request), rawString(name, rm.limit))
+		if cp.showUtil {
+			row = append(row, rawString(name, rm.utilization))
+		}
+		row = append(row, rawString(name, rm.allocatable))
+	}
+
+	if cp.showPodCount {
+		if pc != nil {
+			row = append(row, fmt.Sprintf("%d", pc.current), fmt.Sprintf("%d", pc.allocatable))
+		} else {
+			row = append(row, "", "")
+		}
+	}
+
+	return row
+}
+
+func rawString(resourceType string, q resource.Quantity) string {
+	return strconv.FormatInt(rawValue(resourceType, q), 10)
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVRows(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	cp := &csvPrinter{
+		cm:     &cm,
+		sortBy: "name",
+	}
+
+	assert.Equal(t, [][]string{
+		{"level", "node", "namespace", "pod", "container",
+			"cpu_requests_millicores", "cpu_limits_millicores", "cpu_allocatable_millicores",
+			"memory_requests_bytes", "memory_limits_bytes", "memory_allocatable_bytes"},
+		{"cluster", "", "", "", "", "900", "1300", "2000", "0", "0", "8388608000"},
+		{"node", "example-node-1", "", "", "", "500", "800", "1000", "0", "0", "4194304000"},
+		{"node", "example-node-2", "", "", "", "400", "500", "1000", "0", "0", "4194304000"},
+	}, cp.rows())
+
+	cp.showContainers = true
+	cp.showUtil = true
+	cp.showPodCount = true
+
+	rows := cp.rows()
+	assert.Len(t, rows, 10)
+	assert.Equal(t, []string{"level", "node", "namespace", "pod", "container", "container_type",
+		"cpu_requests_millicores", "cpu_limits_millicores", "cpu_util_millicores", "cpu_allocatable_millicores",
+		"memory_requests_bytes", "memory_limits_bytes", "memory_util_bytes", "memory_allocatable_bytes",
+		"pods", "pods_allocatable"}, rows[0])
+	assert.Equal(t, []string{"cluster", "", "", "", "", "",
+		"900", "1300", "0", "2000", "0", "0", "0", "8388608000", "3", "220"}, rows[1])
+	assert.Equal(t, []string{"node", "example-node-1", "", "", "", "",
+		"500", "800", "0", "1000", "0", "0", "0", "4194304000", "2", "110"}, rows[2])
+	assert.Equal(t, []string{"pod", "example-node-1", "kube-system", "dns", "", "",
+		"300", "400", "0", "1000", "0", "0", "0", "4194304000", "", ""}, rows[3])
+	assert.Equal(t, []string{"container", "example-node-1", "kube-system", "dns", "dns", "app",
+		"300", "400", "0", "1000", "0", "0", "0", "4194304000", "", ""}, rows[4])
+}
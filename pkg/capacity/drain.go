@@ -0,0 +1,352 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// evictedPod is a pod running on a drained node along with where it would be
+// rescheduled, or why it could not be.
+type evictedPod struct {
+	pod     *corev1.Pod
+	shape   *podShape
+	newNode string
+	reason  string
+}
+
+// DrainOptions selects the nodes FetchAndPrintDrainSim drains, either listed
+// by name or matching a label selector.
+type DrainOptions struct {
+	Nodes    []string
+	Selector string
+}
+
+// FetchAndPrintDrainSim simulates draining the given nodes, or the nodes
+// matching a label selector, and writes where their pods would be
+// rescheduled along with the resulting requests on the remaining nodes. It
+// returns ErrDoesNotFit if any pods would become unschedulable.
+func FetchAndPrintDrainSim(ctx context.Context, w io.Writer, opts Options, printOpts PrintOptions, drainOpts DrainOptions) error {
+	if len(opts.ResourceNames) == 0 {
+		opts.ResourceNames = DefaultResources
+	}
+	if printOpts.Output == "" {
+		printOpts.Output = TableOutput
+	}
+	if printOpts.SortBy == "" {
+		printOpts.SortBy = "name"
+	}
+
+	clientset, _, err := opts.clientsets()
+	if err != nil {
+		return err
+	}
+
+	podList, nodeList, err := getPodsAndNodes(withRequestTimeout(ctx, opts.RequestTimeout), clientset, "", "", opts.NodeLabels,
+		"", "", opts.ChunkSize)
+	if err != nil {
+		return err
+	}
+
+	drained, err := selectDrainedNodes(nodeList, drainOpts.Nodes, drainOpts.Selector)
+	if err != nil {
+		return err
+	}
+
+	evicted := simulateDrain(podList, nodeList, drained, opts.ResourceNames)
+
+	cm := buildClusterMetric(drainedPodList(podList, drained, evicted), nil,
+		drainedNodeList(nodeList, drained), nil, evictedResourceNames(opts.ResourceNames, evicted))
+
+	switch printOpts.Output {
+	case JSONOutput, YAMLOutput:
+		err = printListDrainSim(w, &cm, drained, evicted, printOpts.ShowPods, printOpts.ShowPodCount, printOpts.Output,
+			printOpts.SortBy)
+	case TableOutput:
+		err = printTableDrainSim(w, &cm, evicted, printOpts.ShowPods, printOpts.ShowPodCount, printOpts.AvailableFormat,
+			printOpts.SortBy)
+	default:
+		return fmt.Errorf("Called with an unsupported output type: %s", printOpts.Output)
+	}
+	if err != nil {
+		return err
+	}
+
+	if countUnschedulable(evicted) > 0 {
+		return ErrDoesNotFit
+	}
+	return nil
+}
+
+// selectDrainedNodes returns the names of the nodes to drain, either listed
+// explicitly or matching a label selector.
+func selectDrainedNodes(nodeList *corev1.NodeList, drainNodes []string, drainSelector string) (map[string]bool, error) {
+	drained := map[string]bool{}
+
+	nodes := map[string]bool{}
+	for _, node := range nodeList.Items {
+		nodes[node.Name] = true
+	}
+
+	for _, name := range drainNodes {
+		if !nodes[name] {
+			return nil, fmt.Errorf("Node %s not found", name)
+		}
+		drained[name] = true
+	}
+
+	if drainSelector != "" {
+		selector, err := labels.Parse(drainSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing node selector: %v", err)
+		}
+		for _, node := range nodeList.Items {
+			if selector.Matches(labels.Set(node.Labels)) {
+				drained[node.Name] = true
+			}
+		}
+	}
+
+	if len(drained) == 0 {
+		return nil, fmt.Errorf("No nodes selected to drain")
+	}
+
+	return drained, nil
+}
+
+// simulateDrain removes the drained nodes and tries to place the pods that
+// would be evicted from them on the remaining nodes, largest requests first.
+// DaemonSet and mirror pods are skipped like kubectl drain does, as they are
+// not rescheduled elsewhere.
+func simulateDrain(podList *corev1.PodList, nodeList *corev1.NodeList, drained map[string]bool, resourceNames []string) []*evictedPod {
+	evicted := []*evictedPod{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if !drained[pod.Spec.NodeName] || !isEvictable(pod) {
+			continue
+		}
+
+		shape := newPodShapeFromSpec(pod.Namespace, pod.Labels, &pod.Spec)
+		shape.nodeName = ""
+		evicted = append(evicted, &evictedPod{pod: pod, shape: shape})
+	}
+
+	sort.SliceStable(evicted, func(i, j int) bool {
+		return compareShapeRequests(evicted[i].shape, evicted[j].shape) > 0
+	})
+
+	cm := buildClusterMetric(drainedPodList(podList, drained, nil), nil,
+		drainedNodeList(nodeList, drained), nil, evictedResourceNames(resourceNames, evicted))
+	nodeMetrics := cm.getSortedNodeMetrics("name")
+
+	for _, ep := range evicted {
+		if nm := cm.place(ep.shape, nodeMetrics); nm != nil {
+			ep.newNode = nm.name
+		} else {
+			ep.reason = unschedulableReason(ep.shape, nodeMetrics)
+		}
+	}
+
+	return evicted
+}
+
+// isEvictable returns false for pods that would not be rescheduled elsewhere
+// when their node is drained.
+func isEvictable(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+
+	return true
+}
+
+// compareShapeRequests orders shapes by CPU requests, then memory requests.
+func compareShapeRequests(ps1, ps2 *podShape) int {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q1 := ps1.requests[name]
+		if c := q1.Cmp(ps2.requests[name]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// evictedResourceNames adds any resources requested by evicted pods to the
+// resources to include, so that they are taken into account when placing.
+func evictedResourceNames(resourceNames []string, evicted []*evictedPod) []string {
+	shapes := []*podShape{}
+	for _, ep := range evicted {
+		shapes = append(shapes, ep.shape)
+	}
+
+	names := append([]string{}, resourceNames...)
+	for _, name := range shapeResourceNames(shapes...) {
+		if !containsResource(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func drainedNodeList(nodeList *corev1.NodeList, drained map[string]bool) *corev1.NodeList {
+	remaining := &corev1.NodeList{}
+	for _, node := range nodeList.Items {
+		if !drained[node.Name] {
+			remaining.Items = append(remaining.Items, node)
+		}
+	}
+	return remaining
+}
+
+// drainedPodList returns the pods left on the remaining nodes, including the
+// evicted pods that could be placed on them.
+func drainedPodList(podList *corev1.PodList, drained map[string]bool, evicted []*evictedPod) *corev1.PodList {
+	remaining := &corev1.PodList{}
+	for _, pod := range podList.Items {
+		if !drained[pod.Spec.NodeName] {
+			remaining.Items = append(remaining.Items, pod)
+		}
+	}
+
+	for _, ep := range evicted {
+		if ep.newNode != "" {
+			pod := ep.pod.DeepCopy()
+			pod.Spec.NodeName = ep.newNode
+			remaining.Items = append(remaining.Items, *pod)
+		}
+	}
+
+	return remaining
+}
+
+func printTableDrainSim(out io.Writer, cm *clusterMetric, evicted []*evictedPod, showPods, showPodCount, availableFormat bool,
+	sortBy string) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, strings.Join([]string{"NAMESPACE", "POD", "NODE", "NEW NODE", "REASON"}, "\t "))
+	for _, ep := range evicted {
+		newNode := ep.newNode
+		if newNode == "" {
+			newNode = "<none>"
+		}
+		fmt.Fprintln(w, strings.Join([]string{ep.pod.Namespace, ep.pod.Name, ep.pod.Spec.NodeName, newNode, ep.reason}, "\t "))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	tp := &tablePrinter{
+		cm:              cm,
+		showPods:        showPods,
+		showPodCount:    showPodCount,
+		showNamespace:   true,
+		sortBy:          sortBy,
+		w:               new(tabwriter.Writer),
+		availableFormat: availableFormat,
+	}
+	if err := tp.Print(out); err != nil {
+		return err
+	}
+
+	var err error
+	unschedulable := countUnschedulable(evicted)
+	if unschedulable > 0 {
+		_, err = fmt.Fprintf(out, "\n%d of %d evicted pods would be unschedulable\n", unschedulable, len(evicted))
+	} else {
+		_, err = fmt.Fprintf(out, "\nAll %d evicted pods can be rescheduled\n", len(evicted))
+	}
+	return err
+}
+
+func countUnschedulable(evicted []*evictedPod) int {
+	count := 0
+	for _, ep := range evicted {
+		if ep.newNode == "" {
+			count++
+		}
+	}
+	return count
+}
+
+type listDrainSim struct {
+	DrainedNodes  []string              `json:"drainedNodes"`
+	EvictedPods   []*listEvictedPod     `json:"evictedPods"`
+	Unschedulable int                   `json:"unschedulable"`
+	Cluster       *apiv1.ClusterMetrics `json:"cluster"`
+}
+
+type listEvictedPod struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node"`
+	NewNode   string `json:"newNode,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func printListDrainSim(out io.Writer, cm *clusterMetric, drained map[string]bool, evicted []*evictedPod, showPods, showPodCount bool,
+	output, sortBy string) error {
+	lp := &listPrinter{
+		cm:           cm,
+		showPods:     showPods,
+		showPodCount: showPodCount,
+		sortBy:       sortBy,
+	}
+	lcm := lp.buildListClusterMetrics()
+
+	lds := listDrainSim{
+		DrainedNodes:  []string{},
+		EvictedPods:   []*listEvictedPod{},
+		Unschedulable: countUnschedulable(evicted),
+		Cluster:       &lcm,
+	}
+
+	for name := range drained {
+		lds.DrainedNodes = append(lds.DrainedNodes, name)
+	}
+	sort.Strings(lds.DrainedNodes)
+
+	for _, ep := range evicted {
+		lds.EvictedPods = append(lds.EvictedPods, &listEvictedPod{
+			Name:      ep.pod.Name,
+			Namespace: ep.pod.Namespace,
+			Node:      ep.pod.Spec.NodeName,
+			NewNode:   ep.newNode,
+			Reason:    ep.reason,
+		})
+	}
+
+	return printListOutput(out, lds, output)
+}
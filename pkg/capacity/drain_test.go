@@ -0,0 +1,98 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSimulateDrain(t *testing.T) {
+	drained := groupTestNode("example-node-1")
+	drained.Labels = map[string]string{"pool": "old"}
+	tainted := groupTestNode("example-node-3")
+	tainted.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+
+	daemon := groupTestPod("example-node-1", "kube-system", "fluentd", "100m", "100m")
+	daemon.OwnerReferences = []metav1.OwnerReference{controllerRef("DaemonSet", "fluentd")}
+
+	nodeList := &corev1.NodeList{
+		Items: []corev1.Node{drained, groupTestNode("example-node-2"), tainted},
+	}
+	podList := &corev1.PodList{
+		Items: []corev1.Pod{
+			groupTestPod("example-node-1", "default", "small", "200m", "200m"),
+			groupTestPod("example-node-1", "default", "large", "600m", "600m"),
+			groupTestPod("example-node-1", "default", "medium", "300m", "300m"),
+			daemon,
+			groupTestPod("example-node-2", "default", "api", "300m", "300m"),
+		},
+	}
+
+	selected, err := selectDrainedNodes(nodeList, nil, "pool=old")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"example-node-1": true}, selected)
+
+	_, err = selectDrainedNodes(nodeList, []string{"missing"}, "")
+	assert.Error(t, err)
+
+	evicted := simulateDrain(podList, nodeList, selected, DefaultResources)
+	assert.Len(t, evicted, 3)
+
+	assert.Equal(t, "large", evicted[0].pod.Name)
+	assert.Equal(t, "example-node-2", evicted[0].newNode)
+	assert.Equal(t, "medium", evicted[1].pod.Name)
+	assert.Equal(t, "", evicted[1].newNode)
+	assert.Equal(t, "0/2 nodes available: 1 insufficient cpu, 1 untolerated taint dedicated=gpu:NoSchedule", evicted[1].reason)
+	assert.Equal(t, "small", evicted[2].pod.Name)
+	assert.Equal(t, "", evicted[2].newNode)
+	assert.Equal(t, 2, countUnschedulable(evicted))
+
+	cm := buildClusterMetric(drainedPodList(podList, selected, evicted), nil,
+		drainedNodeList(nodeList, selected), nil, DefaultResources)
+	assert.Len(t, cm.nodeMetrics, 2)
+	assert.Equal(t, "900m (90%%)", cm.nodeMetrics["example-node-2"].resources["cpu"].requestString(false))
+	assert.Equal(t, "900m (45%%)", cm.resources["cpu"].requestString(false))
+
+	var out bytes.Buffer
+	assert.NoError(t, printTableDrainSim(&out, &cm, evicted, false, false, false, "name"))
+	assert.Contains(t, out.String(), "2 of 3 evicted pods would be unschedulable")
+}
+
+func TestFetchAndPrintDrainSim(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	node2 := groupTestNode("example-node-2")
+	web := groupTestPod("example-node-1", "default", "web", "400m", "400m")
+	api := groupTestPod("example-node-2", "default", "api", "300m", "300m")
+	opts := Options{Clientset: fake.NewSimpleClientset(&node1, &node2, &web, &api)}
+
+	var out bytes.Buffer
+	err := FetchAndPrintDrainSim(context.TODO(), &out, opts, PrintOptions{ShowPods: true},
+		DrainOptions{Nodes: []string{"example-node-1"}})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "example-node-2   *           *     700m (70%)")
+	assert.Contains(t, out.String(), "All 1 evicted pods can be rescheduled")
+
+	err = FetchAndPrintDrainSim(context.TODO(), &out, opts, PrintOptions{},
+		DrainOptions{Nodes: []string{"example-node-1", "example-node-2"}})
+	assert.ErrorIs(t, err, ErrDoesNotFit)
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	// ErrMetricsUnavailable matches errors getting utilization from the
+	// Metrics API, usually because metrics-server is not running.
+	ErrMetricsUnavailable = errors.New("metrics unavailable")
+	// ErrForbidden matches errors caused by missing RBAC permissions.
+	ErrForbidden = errors.New("forbidden")
+	// ErrDoesNotFit is returned when simulated pods could not be scheduled.
+	ErrDoesNotFit = errors.New("does not fit")
+)
+
+// Op describes the step of collecting cluster data that failed.
+type Op string
+
+const (
+	//OpConnect is creating a client for the Kubernetes API
+	OpConnect Op = "connecting to Kubernetes"
+	//OpListNodes is listing nodes
+	OpListNodes Op = "listing Nodes"
+	//OpListPods is listing pods
+	OpListPods Op = "listing Pods"
+	//OpListNamespaces is listing namespaces to filter pods by their labels
+	OpListNamespaces Op = "listing Namespaces"
+	//OpConnectMetrics is creating a client for the Metrics API
+	OpConnectMetrics Op = "connecting to Metrics API"
+	//OpPodMetrics is listing pod utilization
+	OpPodMetrics Op = "getting Pod Metrics"
+	//OpNodeMetrics is listing node utilization
+	OpNodeMetrics Op = "getting Node Metrics"
+)
+
+// Error is returned when collecting cluster data fails. It matches
+// ErrMetricsUnavailable and ErrForbidden with errors.Is where they apply.
+type Error struct {
+	Op  Op
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Error %s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is one of the errors exported by this package.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrMetricsUnavailable:
+		return e.Op == OpConnectMetrics || e.Op == OpPodMetrics || e.Op == OpNodeMetrics
+	case ErrForbidden:
+		return apierrors.IsForbidden(e.Err)
+	}
+	return false
+}
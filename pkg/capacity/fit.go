@@ -0,0 +1,753 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/yaml"
+)
+
+// podShape describes the scheduling requirements of a pod that fit
+// calculations are made for.
+type podShape struct {
+	requests             corev1.ResourceList
+	nodeSelector         map[string]string
+	requiredNodeAffinity *corev1.NodeSelector
+	tolerations          []corev1.Toleration
+	nodeName             string
+	namespace            string
+	labels               map[string]string
+	podAffinity          []*podAffinityTerm
+	podAntiAffinity      []*podAffinityTerm
+	topologySpread       []*topologySpread
+}
+
+// nodeFit records how many pods of a shape fit on a node. When none fit,
+// reason explains why.
+type nodeFit struct {
+	name          string
+	available     map[string]resource.Quantity
+	podsAvailable int64
+	count         int64
+	reason        string
+}
+
+// workloadPlacement records where the replicas of a workload were placed.
+type workloadPlacement struct {
+	workload *manifestWorkload
+	nodes    map[string]int64
+	placed   int64
+	reason   string
+}
+
+// FitOptions describes the pods FetchAndPrintFit checks, either the
+// workloads in a manifest or a single pod shape.
+type FitOptions struct {
+	// Filename is a manifest with the workloads to place, or - for stdin.
+	Filename string
+
+	CPU    string
+	Memory string
+	// Requests are other resources requested by each pod, e.g.
+	// nvidia.com/gpu=1.
+	Requests []string
+	// Replicas is how many pods need to fit. Zero only reports how many do.
+	Replicas     int64
+	NodeSelector string
+	// Tolerations are in the form key[=value][:effect].
+	Tolerations []string
+}
+
+// FetchAndPrintFit gathers cluster resource data and writes how many pods of
+// the given shape could still be scheduled on each node. When a filename is
+// given, the workloads in it are placed instead. Only the Output of the print
+// options is used. It returns ErrDoesNotFit if the requested replicas do not
+// fit.
+func FetchAndPrintFit(ctx context.Context, w io.Writer, opts Options, printOpts PrintOptions, fitOpts FitOptions) error {
+	var shape *podShape
+	var workloads []*manifestWorkload
+	var err error
+
+	if fitOpts.Filename != "" {
+		workloads, err = readManifestWorkloads(fitOpts.Filename)
+	} else {
+		shape, err = newPodShape(fitOpts.CPU, fitOpts.Memory, fitOpts.Requests, fitOpts.NodeSelector, fitOpts.Tolerations)
+	}
+	if err != nil {
+		return err
+	}
+
+	clientset, _, err := opts.clientsets()
+	if err != nil {
+		return err
+	}
+
+	podList, nodeList, err := getPodsAndNodes(withRequestTimeout(ctx, opts.RequestTimeout), clientset, "", "", opts.NodeLabels,
+		"", "", opts.ChunkSize)
+	if err != nil {
+		return err
+	}
+
+	var fits bool
+	if workloads != nil {
+		shapes := []*podShape{}
+		for _, workload := range workloads {
+			shapes = append(shapes, workload.shape)
+		}
+
+		cm := buildClusterMetric(podList, nil, nodeList, nil, shapeResourceNames(shapes...))
+		fits, err = printPlacements(w, &cm, workloads, printOpts.Output)
+	} else {
+		cm := buildClusterMetric(podList, nil, nodeList, nil, shapeResourceNames(shape))
+		fits, err = printFit(w, &cm, shape, fitOpts.Replicas, printOpts.Output)
+	}
+
+	if err != nil {
+		return err
+	}
+	if !fits {
+		return ErrDoesNotFit
+	}
+	return nil
+}
+
+func newPodShape(cpu, memory string, requests []string, nodeSelector string, tolerations []string) (*podShape, error) {
+	shape := &podShape{
+		requests: corev1.ResourceList{},
+	}
+
+	if cpu != "" {
+		requests = append(requests, fmt.Sprintf("%s=%s", corev1.ResourceCPU, cpu))
+	}
+	if memory != "" {
+		requests = append(requests, fmt.Sprintf("%s=%s", corev1.ResourceMemory, memory))
+	}
+
+	for _, request := range requests {
+		parts := strings.SplitN(request, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid resource request %q, expected <resource>=<quantity>", request)
+		}
+
+		q, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid quantity for %s: %v", parts[0], err)
+		}
+		shape.requests[corev1.ResourceName(parts[0])] = q
+	}
+
+	if nodeSelector != "" {
+		selector, err := labels.ConvertSelectorToLabelsMap(nodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid node selector: %v", err)
+		}
+		shape.nodeSelector = selector
+	}
+
+	for _, toleration := range tolerations {
+		t, err := parseToleration(toleration)
+		if err != nil {
+			return nil, err
+		}
+		shape.tolerations = append(shape.tolerations, t)
+	}
+
+	return shape, nil
+}
+
+// parseToleration parses a toleration in the form key[=value][:effect]. A
+// toleration without a value tolerates any value for the key, and one without
+// an effect tolerates every effect.
+func parseToleration(toleration string) (corev1.Toleration, error) {
+	t := corev1.Toleration{}
+
+	keyValue := toleration
+	if i := strings.LastIndex(toleration, ":"); i >= 0 {
+		keyValue = toleration[:i]
+		t.Effect = corev1.TaintEffect(toleration[i+1:])
+		switch t.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return t, fmt.Errorf("Invalid toleration %q, unknown effect %q", toleration, t.Effect)
+		}
+	}
+
+	if parts := strings.SplitN(keyValue, "=", 2); len(parts) == 2 {
+		t.Key = parts[0]
+		t.Value = parts[1]
+		t.Operator = corev1.TolerationOpEqual
+	} else {
+		t.Key = keyValue
+		t.Operator = corev1.TolerationOpExists
+	}
+
+	if t.Key == "" {
+		return t, fmt.Errorf("Invalid toleration %q, a key is required", toleration)
+	}
+
+	return t, nil
+}
+
+// shapeResourceNames returns the resources needed to evaluate the shapes,
+// starting with the default resources.
+func shapeResourceNames(shapes ...*podShape) []string {
+	resourceNames := append([]string{}, DefaultResources...)
+
+	extra := []string{}
+	for _, shape := range shapes {
+		for name := range shape.requests {
+			if !containsResource(resourceNames, string(name)) && !containsResource(extra, string(name)) {
+				extra = append(extra, string(name))
+			}
+		}
+	}
+	sort.Strings(extra)
+
+	return append(resourceNames, extra...)
+}
+
+// requestedResourceNames returns the sorted names of the resources the shape
+// requests.
+func (ps *podShape) requestedResourceNames() []string {
+	names := []string{}
+	for name := range ps.requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// schedulingReason returns why a pod of this shape cannot be scheduled on the
+// node regardless of available resources, or an empty string if it can.
+func (ps *podShape) schedulingReason(nm *nodeMetric) string {
+	if nm.unschedulable {
+		return "node is unschedulable"
+	}
+
+	if ps.nodeName != "" && ps.nodeName != nm.name {
+		return "node name does not match"
+	}
+
+	if reason := ps.nodeAffinityReason(nm); reason != "" {
+		return reason
+	}
+
+	for i := range nm.taints {
+		taint := &nm.taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !ps.tolerates(taint) {
+			return fmt.Sprintf("untolerated taint %s", taint.ToString())
+		}
+	}
+
+	return ""
+}
+
+// nodeAffinityReason returns why the node does not match the node selector or
+// required node affinity of the shape, or an empty string if it does.
+func (ps *podShape) nodeAffinityReason(nm *nodeMetric) string {
+	for key, value := range ps.nodeSelector {
+		if nm.labels[key] != value {
+			return fmt.Sprintf("node selector %s=%s does not match", key, value)
+		}
+	}
+	if ps.requiredNodeAffinity != nil && !nodeSelectorMatches(ps.requiredNodeAffinity, nm) {
+		return "node affinity does not match"
+	}
+	return ""
+}
+
+// nodeSelectorMatches returns true if the node matches any of the terms of a
+// required node affinity.
+func nodeSelectorMatches(selector *corev1.NodeSelector, nm *nodeMetric) bool {
+	for _, term := range selector.NodeSelectorTerms {
+		if nodeSelectorTermMatches(term, nm) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeSelectorTermMatches returns true if the node matches all requirements of
+// the term. Like the scheduler, an empty term matches no nodes.
+func nodeSelectorTermMatches(term corev1.NodeSelectorTerm, nm *nodeMetric) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+
+	for _, req := range term.MatchExpressions {
+		if !nodeSelectorRequirementMatches(req, labels.Set(nm.labels)) {
+			return false
+		}
+	}
+
+	for _, req := range term.MatchFields {
+		if req.Key != "metadata.name" || !nodeSelectorRequirementMatches(req, labels.Set{req.Key: nm.name}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func nodeSelectorRequirementMatches(req corev1.NodeSelectorRequirement, set labels.Set) bool {
+	var op selection.Operator
+	switch req.Operator {
+	case corev1.NodeSelectorOpIn:
+		op = selection.In
+	case corev1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case corev1.NodeSelectorOpExists:
+		op = selection.Exists
+	case corev1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case corev1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case corev1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return false
+	}
+
+	r, err := labels.NewRequirement(req.Key, op, req.Values)
+	if err != nil {
+		return false
+	}
+	return r.Matches(set)
+}
+
+func (ps *podShape) tolerates(taint *corev1.Taint) bool {
+	for i := range ps.tolerations {
+		if ps.tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// fit calculates how many pods of the given shape fit on the node based on
+// allocatable resources minus requests, and the remaining pod capacity.
+func (nm *nodeMetric) fit(shape *podShape) *nodeFit {
+	nf := &nodeFit{
+		name:          nm.name,
+		available:     map[string]resource.Quantity{},
+		podsAvailable: nm.podCount.allocatable - nm.podCount.current,
+	}
+
+	for _, name := range shape.requestedResourceNames() {
+		var available resource.Quantity
+		if rm, ok := nm.resources[name]; ok {
+			available = rm.allocatable.DeepCopy()
+			available.Sub(rm.request)
+		}
+		nf.available[name] = available
+	}
+
+	if nf.reason = shape.schedulingReason(nm); nf.reason != "" {
+		return nf
+	}
+
+	nf.count = nf.podsAvailable
+	if nf.count <= 0 {
+		nf.count = 0
+		nf.reason = "too many pods"
+		return nf
+	}
+
+	for _, name := range shape.requestedResourceNames() {
+		request := shape.requests[corev1.ResourceName(name)]
+		if request.MilliValue() <= 0 {
+			continue
+		}
+
+		available := nf.available[name]
+		count := available.MilliValue() / request.MilliValue()
+		if count < nf.count {
+			nf.count = count
+		}
+
+		if nf.count <= 0 {
+			nf.count = 0
+			nf.reason = fmt.Sprintf("insufficient %s", name)
+			return nf
+		}
+	}
+
+	return nf
+}
+
+func (cm *clusterMetric) getNodeFits(shape *podShape) []*nodeFit {
+	nodeFits := []*nodeFit{}
+	for _, nm := range cm.getSortedNodeMetrics("name") {
+		nodeFits = append(nodeFits, nm.fit(shape))
+	}
+	return nodeFits
+}
+
+// addPod adds the requests of a pod of the given shape to the node, along
+// with the pod itself so that later pods see it when checking inter-pod
+// constraints.
+func (nm *nodeMetric) addPod(shape *podShape) {
+	for name, q := range shape.requests {
+		if rm, ok := nm.resources[string(name)]; ok {
+			rm.request.Add(q)
+		}
+	}
+
+	key := fmt.Sprintf("%s/<placed-%d>", shape.namespace, len(nm.podMetrics))
+	nm.podMetrics[key] = &podMetric{
+		namespace:        shape.namespace,
+		labels:           shape.labels,
+		resources:        resourceMetrics{},
+		containerMetrics: map[string]*containerMetric{},
+		antiAffinity:     shape.podAntiAffinity,
+	}
+	if len(shape.podAntiAffinity) > 0 {
+		nm.antiAffinityPods++
+	}
+	nm.podCount.current++
+}
+
+// place assigns a pod of the given shape to the node with room for the most
+// pods of that shape, spreading pods similarly to the scheduler's default
+// scoring. Nodes where required pod affinity, anti-affinity or topology
+// spread constraints would not be met are skipped. It returns nil if the pod
+// does not fit on any node.
+func (cm *clusterMetric) place(shape *podShape, nodeMetrics []*nodeMetric) *nodeMetric {
+	var best *nodeMetric
+	var bestCount int64
+
+	tc := newTopologyCounts(shape, nodeMetrics)
+	for _, nm := range nodeMetrics {
+		if count := nm.fit(shape).count; count > bestCount && tc.reason(nm) == "" {
+			best, bestCount = nm, count
+		}
+	}
+
+	if best != nil {
+		best.addPod(shape)
+		cm.podCount.current++
+		for name, q := range shape.requests {
+			if rm, ok := cm.resources[string(name)]; ok {
+				rm.request.Add(q)
+			}
+		}
+	}
+
+	return best
+}
+
+// unschedulableReason summarizes why a pod of the given shape does not fit on
+// any node, e.g. "0/3 nodes available: 2 insufficient cpu, 1 node is
+// unschedulable".
+func unschedulableReason(shape *podShape, nodeMetrics []*nodeMetric) string {
+	counts := map[string]int{}
+	tc := newTopologyCounts(shape, nodeMetrics)
+	for _, nm := range nodeMetrics {
+		if nf := nm.fit(shape); nf.count == 0 {
+			counts[nf.reason]++
+		} else if reason := tc.reason(nm); reason != "" {
+			counts[reason]++
+		}
+	}
+
+	reasons := []string{}
+	for reason, count := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d %s", count, reason))
+	}
+	sort.Strings(reasons)
+
+	return fmt.Sprintf("0/%d nodes available: %s", len(nodeMetrics), strings.Join(reasons, ", "))
+}
+
+// placeWorkloads places the replicas of each workload in turn, so later
+// workloads see the requests of earlier ones.
+func (cm *clusterMetric) placeWorkloads(workloads []*manifestWorkload) []*workloadPlacement {
+	nodeMetrics := cm.getSortedNodeMetrics("name")
+	placements := []*workloadPlacement{}
+
+	for _, workload := range workloads {
+		wp := &workloadPlacement{
+			workload: workload,
+			nodes:    map[string]int64{},
+		}
+
+		for i := int64(0); i < workload.replicas; i++ {
+			nm := cm.place(workload.shape, nodeMetrics)
+			if nm == nil {
+				wp.reason = unschedulableReason(workload.shape, nodeMetrics)
+				break
+			}
+			wp.nodes[nm.name]++
+			wp.placed++
+		}
+
+		placements = append(placements, wp)
+	}
+
+	return placements
+}
+
+type listFit struct {
+	Requests map[string]string `json:"requests"`
+	Replicas int64             `json:"replicas,omitempty"`
+	Fits     *bool             `json:"fits,omitempty"`
+	Total    int64             `json:"total"`
+	Nodes    []*listNodeFit    `json:"nodes"`
+}
+
+type listNodeFit struct {
+	Name          string            `json:"name"`
+	Available     map[string]string `json:"available"`
+	PodsAvailable int64             `json:"podsAvailable"`
+	Fit           int64             `json:"fit"`
+	Reason        string            `json:"reason,omitempty"`
+}
+
+// printFit prints how many pods of a shape fit on each node and returns false
+// if fewer than the requested replicas fit.
+func printFit(out io.Writer, cm *clusterMetric, shape *podShape, replicas int64, output string) (bool, error) {
+	nodeFits := cm.getNodeFits(shape)
+
+	var total int64
+	for _, nf := range nodeFits {
+		total += nf.count
+	}
+
+	var err error
+	if output == JSONOutput || output == YAMLOutput {
+		err = printListFit(out, shape, nodeFits, total, replicas, output)
+	} else if output == TableOutput {
+		err = printTableFit(out, shape, nodeFits, total, replicas)
+	} else {
+		return false, fmt.Errorf("Called with an unsupported output type: %s", output)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return total >= replicas, nil
+}
+
+func printTableFit(out io.Writer, shape *podShape, nodeFits []*nodeFit, total, replicas int64) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+
+	resourceNames := shape.requestedResourceNames()
+
+	header := []string{"NODE"}
+	for _, name := range resourceNames {
+		header = append(header, resourceHeader(name)+" AVAILABLE")
+	}
+	header = append(header, "PODS AVAILABLE", "FIT", "REASON")
+	fmt.Fprintln(w, strings.Join(header, "\t "))
+
+	totals := []string{"*"}
+	for range resourceNames {
+		totals = append(totals, "")
+	}
+	totals = append(totals, "", fmt.Sprintf("%d", total), "")
+	fmt.Fprintln(w, strings.Join(totals, "\t "))
+
+	for _, nf := range nodeFits {
+		line := []string{nf.name}
+		for _, name := range resourceNames {
+			line = append(line, formatQuantity(name, nf.available[name]))
+		}
+		line = append(line, fmt.Sprintf("%d", nf.podsAvailable), fmt.Sprintf("%d", nf.count), nf.reason)
+		fmt.Fprintln(w, strings.Join(line, "\t "))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var err error
+	if replicas > 0 {
+		if total >= replicas {
+			_, err = fmt.Fprintf(out, "\n%d of %d replicas fit\n", replicas, replicas)
+		} else {
+			_, err = fmt.Fprintf(out, "\nOnly %d of %d replicas fit\n", total, replicas)
+		}
+	}
+	return err
+}
+
+func printListFit(out io.Writer, shape *podShape, nodeFits []*nodeFit, total, replicas int64, output string) error {
+	lf := listFit{
+		Requests: map[string]string{},
+		Total:    total,
+		Nodes:    []*listNodeFit{},
+	}
+
+	for name, q := range shape.requests {
+		lf.Requests[string(name)] = q.String()
+	}
+
+	if replicas > 0 {
+		fits := total >= replicas
+		lf.Replicas = replicas
+		lf.Fits = &fits
+	}
+
+	for _, nf := range nodeFits {
+		lnf := &listNodeFit{
+			Name:          nf.name,
+			Available:     map[string]string{},
+			PodsAvailable: nf.podsAvailable,
+			Fit:           nf.count,
+			Reason:        nf.reason,
+		}
+		for name, q := range nf.available {
+			lnf.Available[name] = formatQuantity(name, q)
+		}
+		lf.Nodes = append(lf.Nodes, lnf)
+	}
+
+	return printListOutput(out, lf, output)
+}
+
+type listPlacements struct {
+	Fits      bool                     `json:"fits"`
+	Workloads []*listWorkloadPlacement `json:"workloads"`
+}
+
+type listWorkloadPlacement struct {
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Requests  map[string]string `json:"requests"`
+	Replicas  int64             `json:"replicas"`
+	Placed    int64             `json:"placed"`
+	Nodes     map[string]int64  `json:"nodes"`
+	Reason    string            `json:"reason,omitempty"`
+}
+
+// printPlacements prints where the replicas of each workload would be placed
+// and returns false if any of them do not fit.
+func printPlacements(out io.Writer, cm *clusterMetric, workloads []*manifestWorkload, output string) (bool, error) {
+	placements := cm.placeWorkloads(workloads)
+
+	fits := true
+	for _, wp := range placements {
+		fits = fits && wp.placed >= wp.workload.replicas
+	}
+
+	var err error
+	if output == JSONOutput || output == YAMLOutput {
+		lp := listPlacements{
+			Fits:      fits,
+			Workloads: []*listWorkloadPlacement{},
+		}
+
+		for _, wp := range placements {
+			lwp := &listWorkloadPlacement{
+				Kind:      wp.workload.ref.kind,
+				Name:      wp.workload.ref.name,
+				Namespace: wp.workload.namespace,
+				Requests:  map[string]string{},
+				Replicas:  wp.workload.replicas,
+				Placed:    wp.placed,
+				Nodes:     wp.nodes,
+				Reason:    wp.reason,
+			}
+			for name, q := range wp.workload.shape.requests {
+				lwp.Requests[string(name)] = q.String()
+			}
+			lp.Workloads = append(lp.Workloads, lwp)
+		}
+
+		err = printListOutput(out, lp, output)
+	} else if output == TableOutput {
+		err = printTablePlacements(out, placements)
+	} else {
+		return false, fmt.Errorf("Called with an unsupported output type: %s", output)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return fits, nil
+}
+
+func printTablePlacements(out io.Writer, placements []*workloadPlacement) error {
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, strings.Join([]string{"WORKLOAD", "NODE", "REPLICAS"}, "\t "))
+
+	for _, wp := range placements {
+		workload := wp.workload.ref.String()
+		fmt.Fprintln(w, strings.Join([]string{workload, "*", fmt.Sprintf("%d/%d", wp.placed, wp.workload.replicas)}, "\t "))
+
+		nodeNames := []string{}
+		for name := range wp.nodes {
+			nodeNames = append(nodeNames, name)
+		}
+		sort.Strings(nodeNames)
+
+		for _, name := range nodeNames {
+			fmt.Fprintln(w, strings.Join([]string{workload, name, fmt.Sprintf("%d", wp.nodes[name])}, "\t "))
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, wp := range placements {
+		if wp.placed < wp.workload.replicas {
+			_, err := fmt.Fprintf(out, "\n%s: %d of %d replicas do not fit (%s)\n",
+				wp.workload.ref, wp.workload.replicas-wp.placed, wp.workload.replicas, wp.reason)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printListOutput prints a list output struct as JSON or YAML.
+func printListOutput(out io.Writer, v interface{}, output string) error {
+	jsonRaw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error Marshalling JSON: %v", err)
+	}
+
+	if output == JSONOutput {
+		_, err = fmt.Fprintf(out, "%s", jsonRaw)
+		return err
+	}
+
+	yamlRaw, err := yaml.JSONToYAML(jsonRaw)
+	if err != nil {
+		return fmt.Errorf("Error Converting JSON to Yaml: %v", err)
+	}
+	_, err = fmt.Fprintf(out, "%s", yamlRaw)
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseToleration(t *testing.T) {
+	var testCases = []struct {
+		toleration string
+		expected   corev1.Toleration
+		err        bool
+	}{
+		{
+			toleration: "dedicated=gpu:NoSchedule",
+			expected:   corev1.Toleration{Key: "dedicated", Value: "gpu", Operator: corev1.TolerationOpEqual, Effect: corev1.TaintEffectNoSchedule},
+		}, {
+			toleration: "dedicated:NoExecute",
+			expected:   corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		}, {
+			toleration: "node.kubernetes.io/unreachable",
+			expected:   corev1.Toleration{Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists},
+		}, {
+			toleration: "dedicated=gpu:Sometimes",
+			err:        true,
+		}, {
+			toleration: ":NoSchedule",
+			err:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.toleration, func(t *testing.T) {
+			toleration, err := parseToleration(tc.toleration)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, toleration)
+		})
+	}
+}
+
+func TestNodeFit(t *testing.T) {
+	tainted := groupTestNode("tainted")
+	tainted.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	cordoned := groupTestNode("cordoned")
+	cordoned.Spec.Unschedulable = true
+	ssd := groupTestNode("ssd")
+	ssd.Labels = map[string]string{"disktype": "ssd"}
+	full := groupTestNode("full")
+	full.Status.Allocatable["pods"] = resource.MustParse("1")
+
+	cm := buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				groupTestPod("ssd", "default", "web", "200m", "400m"),
+				groupTestPod("full", "default", "api", "100m", "100m"),
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{tainted, cordoned, ssd, full},
+		}, nil, DefaultResources,
+	)
+
+	shape, err := newPodShape("300m", "", nil, "", nil)
+	assert.NoError(t, err)
+
+	fits := map[string]*nodeFit{}
+	for _, nf := range cm.getNodeFits(shape) {
+		fits[nf.name] = nf
+	}
+
+	assert.Equal(t, int64(0), fits["tainted"].count)
+	assert.Equal(t, "untolerated taint dedicated=gpu:NoSchedule", fits["tainted"].reason)
+	assert.Equal(t, int64(0), fits["cordoned"].count)
+	assert.Equal(t, "node is unschedulable", fits["cordoned"].reason)
+	assert.Equal(t, int64(2), fits["ssd"].count)
+	assert.Equal(t, "800m", formatQuantity("cpu", fits["ssd"].available["cpu"]))
+	assert.Equal(t, int64(109), fits["ssd"].podsAvailable)
+	assert.Equal(t, int64(0), fits["full"].count)
+	assert.Equal(t, "too many pods", fits["full"].reason)
+
+	shape, err = newPodShape("300m", "1Gi", nil, "disktype=ssd", []string{"dedicated=gpu:NoSchedule"})
+	assert.NoError(t, err)
+
+	fits = map[string]*nodeFit{}
+	for _, nf := range cm.getNodeFits(shape) {
+		fits[nf.name] = nf
+	}
+
+	assert.Equal(t, "node selector disktype=ssd does not match", fits["tainted"].reason)
+	assert.Equal(t, int64(2), fits["ssd"].count)
+
+	shape, err = newPodShape("", "", []string{"nvidia.com/gpu=1"}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu", "memory", "nvidia.com/gpu"}, shapeResourceNames(shape))
+	assert.Equal(t, "insufficient nvidia.com/gpu", cm.nodeMetrics["ssd"].fit(shape).reason)
+}
+
+func TestPrintFit(t *testing.T) {
+	cm := buildClusterMetric(&corev1.PodList{}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}, nil, DefaultResources)
+
+	shape, err := newPodShape("300m", "", nil, "", nil)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	fits, err := printFit(&out, &cm, shape, 5, TableOutput)
+	assert.NoError(t, err)
+	assert.False(t, fits)
+	assert.Contains(t, out.String(), "example-node-1")
+	assert.Contains(t, out.String(), "Only 3 of 5 replicas fit")
+
+	out.Reset()
+	fits, err = printFit(&out, &cm, shape, 3, JSONOutput)
+	assert.NoError(t, err)
+	assert.True(t, fits)
+
+	var lf listFit
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &lf))
+	assert.Equal(t, int64(3), lf.Total)
+}
+
+func TestFetchAndPrintFit(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "400m", "400m")
+	opts := Options{Clientset: fake.NewSimpleClientset(&node1, &web)}
+
+	var out bytes.Buffer
+	err := FetchAndPrintFit(context.TODO(), &out, opts, PrintOptions{Output: JSONOutput}, FitOptions{CPU: "200m", Replicas: 3})
+	assert.NoError(t, err)
+
+	var lf listFit
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &lf))
+	assert.Equal(t, int64(3), lf.Total)
+
+	out.Reset()
+	err = FetchAndPrintFit(context.TODO(), &out, opts, PrintOptions{Output: TableOutput}, FitOptions{CPU: "200m", Replicas: 4})
+	assert.ErrorIs(t, err, ErrDoesNotFit)
+	assert.Contains(t, out.String(), "Only 3 of 4 replicas fit")
+}
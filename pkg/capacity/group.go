@@ -0,0 +1,204 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	//NodeGrouping is the constant value for grouping output by node
+	NodeGrouping string = "node"
+	//NamespaceGrouping is the constant value for grouping output by namespace
+	NamespaceGrouping string = "namespace"
+	//WorkloadGrouping is the constant value for grouping output by workload
+	WorkloadGrouping string = "workload"
+)
+
+// SupportedGroupings returns a string list of groupings supported by this package
+func SupportedGroupings() []string {
+	return []string{
+		NodeGrouping,
+		NamespaceGrouping,
+		WorkloadGrouping,
+	}
+}
+
+// groupMetric aggregates the pods sharing a namespace or workload.
+// Percentages are relative to the allocatable resources of the whole cluster.
+type groupMetric struct {
+	name       string
+	namespace  string
+	kind       string
+	resources  resourceMetrics
+	podMetrics map[string]*podMetric
+	podCount   *podCount
+}
+
+// groupsPods returns true when output is grouped by a property of pods
+// rather than by node.
+func groupsPods(groupBy string) bool {
+	return groupBy == NamespaceGrouping || groupBy == WorkloadGrouping
+}
+
+func (cm *clusterMetric) buildGroupMetrics(groupBy string) map[string]*groupMetric {
+	groupMetrics := map[string]*groupMetric{}
+
+	for _, nm := range cm.nodeMetrics {
+		for key, pm := range nm.podMetrics {
+			name, kind := pm.namespace, ""
+			if groupBy == WorkloadGrouping {
+				wr := pm.getWorkload()
+				name, kind = wr.name, wr.kind
+			}
+			groupKey := fmt.Sprintf("%s/%s/%s", pm.namespace, kind, name)
+
+			gm, ok := groupMetrics[groupKey]
+			if !ok {
+				gm = &groupMetric{
+					name:       name,
+					namespace:  pm.namespace,
+					kind:       kind,
+					resources:  newResourceMetrics(cm.resourceNames),
+					podMetrics: map[string]*podMetric{},
+					podCount:   &podCount{allocatable: cm.podCount.allocatable},
+				}
+				for name, rm := range gm.resources {
+					rm.allocatable = cm.resources[name].allocatable
+				}
+				groupMetrics[groupKey] = gm
+			}
+
+			gm.podMetrics[key] = pm
+			gm.podCount.current++
+			for name, rm := range gm.resources {
+				rm.request.Add(pm.resources[name].request)
+				rm.limit.Add(pm.resources[name].limit)
+				rm.overhead.Add(pm.resources[name].overhead)
+				rm.utilization.Add(pm.resources[name].utilization)
+			}
+		}
+	}
+
+	return groupMetrics
+}
+
+func (cm *clusterMetric) getSortedGroupMetrics(groupBy, sortBy string) []*groupMetric {
+	groupMetrics := cm.buildGroupMetrics(groupBy)
+	sortedGroupMetrics := make([]*groupMetric, len(groupMetrics))
+
+	i := 0
+	for key := range groupMetrics {
+		sortedGroupMetrics[i] = groupMetrics[key]
+		i++
+	}
+
+	sort.Slice(sortedGroupMetrics, func(i, j int) bool {
+		m1 := sortedGroupMetrics[i]
+		m2 := sortedGroupMetrics[j]
+
+		if c := compareResourceMetrics(m1.resources, m2.resources, sortBy); c != 0 {
+			return c > 0
+		}
+		if m1.namespace != m2.namespace {
+			return m1.namespace < m2.namespace
+		}
+		if m1.kind != m2.kind {
+			return m1.kind < m2.kind
+		}
+		return m1.name < m2.name
+	})
+
+	return sortedGroupMetrics
+}
+
+// workloadString returns the "Kind/name" representation of a workload group.
+func (gm *groupMetric) workloadString() string {
+	return workloadRef{kind: gm.kind, name: gm.name}.String()
+}
+
+func (gm *groupMetric) getSortedPodMetrics(sortBy string) []*podMetric {
+	return sortPodMetrics(gm.podMetrics, sortBy)
+}
+
+// noNodeLabelValue is used as the group name for nodes missing the label
+// they are grouped by.
+const noNodeLabelValue = "<none>"
+
+// nodeGroupMetric aggregates the nodes sharing the same value for a label,
+// such as a node pool or zone.
+type nodeGroupMetric struct {
+	name        string
+	resources   resourceMetrics
+	nodeMetrics map[string]*nodeMetric
+	podCount    *podCount
+}
+
+func (cm *clusterMetric) buildNodeGroupMetrics(labelKey string) map[string]*nodeGroupMetric {
+	nodeGroupMetrics := map[string]*nodeGroupMetric{}
+
+	for _, nm := range cm.nodeMetrics {
+		name, ok := nm.labels[labelKey]
+		if !ok {
+			name = noNodeLabelValue
+		}
+
+		ngm, ok := nodeGroupMetrics[name]
+		if !ok {
+			ngm = &nodeGroupMetric{
+				name:        name,
+				resources:   newResourceMetrics(cm.resourceNames),
+				nodeMetrics: map[string]*nodeMetric{},
+				podCount:    &podCount{},
+			}
+			nodeGroupMetrics[name] = ngm
+		}
+
+		ngm.nodeMetrics[nm.name] = nm
+		ngm.resources.addMetrics(nm.resources)
+		ngm.podCount.current += nm.podCount.current
+		ngm.podCount.allocatable += nm.podCount.allocatable
+	}
+
+	return nodeGroupMetrics
+}
+
+func (cm *clusterMetric) getSortedNodeGroupMetrics(labelKey, sortBy string) []*nodeGroupMetric {
+	nodeGroupMetrics := cm.buildNodeGroupMetrics(labelKey)
+	sortedNodeGroupMetrics := make([]*nodeGroupMetric, len(nodeGroupMetrics))
+
+	i := 0
+	for name := range nodeGroupMetrics {
+		sortedNodeGroupMetrics[i] = nodeGroupMetrics[name]
+		i++
+	}
+
+	sort.Slice(sortedNodeGroupMetrics, func(i, j int) bool {
+		m1 := sortedNodeGroupMetrics[i]
+		m2 := sortedNodeGroupMetrics[j]
+
+		if c := compareResourceMetrics(m1.resources, m2.resources, sortBy); c != 0 {
+			return c > 0
+		}
+		return m1.name < m2.name
+	})
+
+	return sortedNodeGroupMetrics
+}
+
+func (ngm *nodeGroupMetric) getSortedNodeMetrics(sortBy string) []*nodeMetric {
+	return sortNodeMetrics(ngm.nodeMetrics, sortBy)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"testing"
+
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetSortedGroupMetricsByNamespace(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	groups := cm.getSortedGroupMetrics(NamespaceGrouping, "cpu.request")
+	assert.Len(t, groups, 2)
+
+	assert.Equal(t, "kube-system", groups[0].name)
+	assert.Equal(t, int64(2), groups[0].podCount.current)
+	assert.Equal(t, int64(220), groups[0].podCount.allocatable)
+	ensureEqualResourceMetric(t, groups[0].resources["cpu"], &resourceMetric{
+		allocatable: resource.MustParse("2000m"),
+		request:     resource.MustParse("700m"),
+		limit:       resource.MustParse("900m"),
+	})
+	assert.Equal(t, "700m (35%%)", groups[0].resources["cpu"].requestString(false))
+
+	assert.Equal(t, "default", groups[1].name)
+	ensureEqualResourceMetric(t, groups[1].resources["cpu"], &resourceMetric{
+		allocatable: resource.MustParse("2000m"),
+		request:     resource.MustParse("200m"),
+		limit:       resource.MustParse("400m"),
+	})
+
+	groups = cm.getSortedGroupMetrics(NamespaceGrouping, "name")
+	assert.Equal(t, "default", groups[0].name)
+	assert.Equal(t, "kube-system", groups[1].name)
+}
+
+func TestBuildListClusterMetricsByNamespace(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	lp := listPrinter{
+		cm:       &cm,
+		showPods: true,
+		groupBy:  NamespaceGrouping,
+	}
+
+	lcm := lp.buildListClusterMetrics()
+
+	assert.Equal(t, []*apiv1.NodeMetric{}, lcm.Nodes)
+	assert.Len(t, lcm.Namespaces, 2)
+	assert.Equal(t, "default", lcm.Namespaces[0].Name)
+	assert.Equal(t, &apiv1.ResourceOutput{
+		Requests:    "200m",
+		RequestsPct: "10%",
+		Limits:      "400m",
+		LimitsPct:   "20%",
+	}, lcm.Namespaces[0].CPU)
+	assert.Len(t, lcm.Namespaces[0].Pods, 1)
+	assert.Len(t, lcm.Namespaces[1].Pods, 2)
+}
+
+func TestGetSortedNodeGroupMetrics(t *testing.T) {
+	zoneA := groupTestNode("example-node-1")
+	zoneA.Labels = map[string]string{"topology.kubernetes.io/zone": "zone-a"}
+	zoneA2 := groupTestNode("example-node-2")
+	zoneA2.Labels = map[string]string{"topology.kubernetes.io/zone": "zone-a"}
+	unlabeled := groupTestNode("example-node-3")
+
+	cm := buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				groupTestPod("example-node-1", "default", "web", "200m", "400m"),
+				groupTestPod("example-node-2", "default", "api", "300m", "400m"),
+				groupTestPod("example-node-3", "default", "db", "100m", "100m"),
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{zoneA, zoneA2, unlabeled},
+		}, nil, DefaultResources,
+	)
+
+	groups := cm.getSortedNodeGroupMetrics("topology.kubernetes.io/zone", "name")
+	assert.Len(t, groups, 2)
+
+	assert.Equal(t, noNodeLabelValue, groups[0].name)
+	assert.Len(t, groups[0].nodeMetrics, 1)
+
+	assert.Equal(t, "zone-a", groups[1].name)
+	assert.Equal(t, "2/220", groups[1].podCount.podCountString())
+	assert.Equal(t, "500m (25%%)", groups[1].resources["cpu"].requestString(false))
+	nodes := groups[1].getSortedNodeMetrics("cpu.request")
+	assert.Equal(t, "example-node-2", nodes[0].name)
+	assert.Equal(t, "example-node-1", nodes[1].name)
+
+	lp := listPrinter{
+		cm:               &cm,
+		groupByNodeLabel: "topology.kubernetes.io/zone",
+	}
+
+	lcm := lp.buildListClusterMetrics()
+	assert.Equal(t, []*apiv1.NodeMetric{}, lcm.Nodes)
+	assert.Len(t, lcm.NodeGroups, 2)
+	assert.Equal(t, "topology.kubernetes.io/zone", lcm.NodeGroups[1].Label)
+	assert.Equal(t, "zone-a", lcm.NodeGroups[1].Value)
+	assert.Equal(t, "500m", lcm.NodeGroups[1].CPU.Requests)
+	assert.Len(t, lcm.NodeGroups[1].Nodes, 2)
+}
+
+func getTestGroupClusterMetric() clusterMetric {
+	return buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				groupTestPod("example-node-1", "default", "web", "200m", "400m"),
+				groupTestPod("example-node-1", "kube-system", "dns", "300m", "400m"),
+				groupTestPod("example-node-2", "kube-system", "proxy", "400m", "500m"),
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{
+				groupTestNode("example-node-1"),
+				groupTestNode("example-node-2"),
+			},
+		}, nil, DefaultResources,
+	)
+}
+
+func groupTestPod(nodeName, namespace, name, cpuRequest, cpuLimit string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Containers: []corev1.Container{
+				{
+					Name: name,
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							"cpu": resource.MustParse(cpuRequest),
+						},
+						Limits: corev1.ResourceList{
+							"cpu": resource.MustParse(cpuLimit),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func groupTestNode(name string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				"cpu":    resource.MustParse("1000m"),
+				"memory": resource.MustParse("4000Mi"),
+				"pods":   resource.MustParse("110"),
+			},
+		},
+	}
+}
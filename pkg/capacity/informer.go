@@ -0,0 +1,538 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// nodeNameIndex indexes pods by the node they are scheduled on, with
+// unscheduled pods under an empty node name.
+const nodeNameIndex = "nodeName"
+
+// informerCollector keeps pods, nodes and namespaces in shared informer
+// caches and updates a cluster metric as they change, so that long-running
+// modes only need to get utilization each time they collect.
+type informerCollector struct {
+	options    Options
+	clientset  kubernetes.Interface
+	mClientset metrics.Interface
+
+	// tolerateMetricsError decides which errors getting utilization are
+	// recorded as warnings rather than failing to collect.
+	tolerateMetricsError func(error) bool
+
+	podInformer       cache.SharedIndexInformer
+	nodeInformer      cache.SharedIndexInformer
+	namespaceInformer cache.SharedIndexInformer
+
+	mu sync.Mutex
+	cm clusterMetric
+	// podNodes is the node each pod in the cluster metric was added to.
+	podNodes map[string]string
+	// namespaces are the namespaces matching the namespace labels, or nil
+	// when pods from every namespace are included.
+	namespaces map[string]bool
+}
+
+// newInformerCollector returns a collector for the options. Informers are
+// not started until start is called.
+func newInformerCollector(opts Options) (*informerCollector, error) {
+	if len(opts.ResourceNames) == 0 {
+		opts.ResourceNames = DefaultResources
+	}
+
+	clientset, mClientset, err := opts.clientsets()
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes come and go while running, so pods are not limited to a single
+	// node like they are when listed once.
+	podFields, err := podFieldSelector(opts.FieldSelector, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &informerCollector{
+		options:              opts,
+		clientset:            clientset,
+		mClientset:           mClientset,
+		tolerateMetricsError: isTimeout,
+		cm: clusterMetric{
+			resourceNames: opts.ResourceNames,
+			nodeMetrics:   map[string]*nodeMetric{},
+			podCount:      &podCount{},
+		},
+		podNodes: map[string]string{},
+	}
+	if opts.Pending {
+		c.cm.addPending()
+	}
+
+	podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(opts.Namespace),
+		informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+			lo.LabelSelector = opts.PodLabels
+			lo.FieldSelector = podFields
+		}))
+	c.podInformer = podFactory.Core().V1().Pods().Informer()
+
+	nodeFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+			lo.LabelSelector = opts.NodeLabels
+		}))
+	c.nodeInformer = nodeFactory.Core().V1().Nodes().Informer()
+
+	if err := c.podInformer.SetTransform(trimPod); err != nil {
+		return nil, err
+	}
+	if err := c.nodeInformer.SetTransform(trimNode); err != nil {
+		return nil, err
+	}
+	if err := c.podInformer.AddIndexers(cache.Indexers{nodeNameIndex: podNodeName}); err != nil {
+		return nil, err
+	}
+
+	c.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.onPod(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { c.onPod(obj, false) },
+		DeleteFunc: func(obj interface{}) { c.onPod(obj, true) },
+	})
+	c.nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.onNode(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { c.onNode(obj, false) },
+		DeleteFunc: func(obj interface{}) { c.onNode(obj, true) },
+	})
+
+	if opts.Namespace == "" && opts.NamespaceLabels != "" {
+		c.namespaces = map[string]bool{}
+
+		namespaceFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+			informers.WithTweakListOptions(func(lo *metav1.ListOptions) {
+				lo.LabelSelector = opts.NamespaceLabels
+			}))
+		c.namespaceInformer = namespaceFactory.Core().V1().Namespaces().Informer()
+
+		if err := c.namespaceInformer.SetTransform(trimNamespace); err != nil {
+			return nil, err
+		}
+		c.namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { c.onNamespace(obj, false) },
+			UpdateFunc: func(_, obj interface{}) { c.onNamespace(obj, false) },
+			DeleteFunc: func(obj interface{}) { c.onNamespace(obj, true) },
+		})
+	}
+
+	return c, nil
+}
+
+// start runs the informers until the context is cancelled, returning once
+// their caches have synced.
+func (c *informerCollector) start(ctx context.Context) error {
+	synced := []cache.InformerSynced{c.podInformer.HasSynced, c.nodeInformer.HasSynced}
+	go c.podInformer.Run(ctx.Done())
+	go c.nodeInformer.Run(ctx.Done())
+	if c.namespaceInformer != nil {
+		go c.namespaceInformer.Run(ctx.Done())
+		synced = append(synced, c.namespaceInformer.HasSynced)
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("Error waiting for caches to sync")
+	}
+
+	// Event handlers may still be catching up with the caches, so the
+	// cluster metric is built from them directly. Handlers add and update
+	// idempotently, so events that arrive afterwards are harmless.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.namespaceInformer != nil {
+		for _, obj := range c.namespaceInformer.GetStore().List() {
+			c.setNamespace(obj.(*corev1.Namespace).Name)
+		}
+	}
+	for _, obj := range c.nodeInformer.GetStore().List() {
+		c.setNode(obj.(*corev1.Node))
+	}
+	if c.cm.pending != nil {
+		c.setPodsOnNode("")
+	}
+
+	return nil
+}
+
+// collect returns the capacity of the cluster as it currently is in the
+// caches, with utilization from the Metrics API if enabled.
+func (c *informerCollector) collect(ctx context.Context) (*ClusterCapacity, error) {
+	ctx = withRequestTimeout(ctx, c.options.RequestTimeout)
+
+	cc := &ClusterCapacity{options: c.options}
+	cc.cm = c.snapshot()
+
+	var nmList *v1beta1.NodeMetricsList
+	if c.options.Utilization {
+		var pmList *v1beta1.PodMetricsList
+		var err error
+		pmList, nmList, err = cc.getUtilization(ctx, c.clientset, c.mClientset, c.tolerateMetricsError)
+		if err != nil {
+			return nil, err
+		}
+		cc.cm.addUtilization(pmList, nmList)
+	}
+	cc.cm.addNodeMetrics(nmList == nil)
+
+	if c.options.Workloads {
+		workloads, warnings := getPodWorkloads(ctx, c.clientset, &cc.cm, c.options.Namespace, c.options.ChunkSize)
+		cc.warnings = append(cc.warnings, warnings...)
+		cc.cm.addWorkloads(workloads)
+	}
+
+	return cc, nil
+}
+
+// snapshot returns a copy of the nodes and pods in the cluster metric that
+// can be modified without affecting the collector.
+func (c *informerCollector) snapshot() clusterMetric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cm := clusterMetric{
+		resourceNames: c.cm.resourceNames,
+		resources:     newResourceMetrics(c.cm.resourceNames),
+		nodeMetrics:   map[string]*nodeMetric{},
+		podCount:      &podCount{},
+	}
+
+	for name, nm := range c.cm.nodeMetrics {
+		cm.nodeMetrics[name] = nm.copy()
+		cm.podCount.current += nm.podCount.current
+		cm.podCount.allocatable += nm.podCount.allocatable
+	}
+	if c.cm.pending != nil {
+		cm.pending = c.cm.pending.copy()
+	}
+
+	return cm
+}
+
+func (c *informerCollector) onPod(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deleted {
+		c.deletePod(podKey(pod))
+	} else {
+		c.setPod(pod)
+	}
+}
+
+func (c *informerCollector) onNode(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deleted {
+		c.deleteNode(node.Name)
+	} else {
+		c.setNode(node)
+	}
+}
+
+func (c *informerCollector) onNamespace(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deleted {
+		c.deleteNamespace(namespace.Name)
+	} else {
+		c.setNamespace(namespace.Name)
+	}
+}
+
+// setPod adds or replaces a pod in the cluster metric. The lock must be held.
+func (c *informerCollector) setPod(pod *corev1.Pod) {
+	key := podKey(pod)
+	c.deletePod(key)
+
+	if !includeNamespace(c.namespaces, pod.Namespace) {
+		return
+	}
+	if c.cm.addPod(pod, nil) {
+		c.podNodes[key] = pod.Spec.NodeName
+	}
+}
+
+// deletePod removes a pod from the cluster metric. The lock must be held.
+func (c *informerCollector) deletePod(key string) {
+	if nodeName, ok := c.podNodes[key]; ok {
+		c.cm.removePod(nodeName, key)
+		delete(c.podNodes, key)
+	}
+}
+
+// setNode adds or replaces a node in the cluster metric along with the pods
+// scheduled on it. The lock must be held.
+func (c *informerCollector) setNode(node *corev1.Node) {
+	c.deleteNode(node.Name)
+	c.cm.nodeMetrics[node.Name] = newNodeMetric(node, c.cm.resourceNames)
+	c.setPodsOnNode(node.Name)
+}
+
+// setPodsOnNode adds or replaces the pods scheduled on a node, or the
+// unscheduled pods for an empty node name. The lock must be held.
+func (c *informerCollector) setPodsOnNode(nodeName string) {
+	pods, err := c.podInformer.GetIndexer().ByIndex(nodeNameIndex, nodeName)
+	if err != nil {
+		return
+	}
+	for _, obj := range pods {
+		c.setPod(obj.(*corev1.Pod))
+	}
+}
+
+// deleteNode removes a node and its pods from the cluster metric. The lock
+// must be held.
+func (c *informerCollector) deleteNode(name string) {
+	nm, ok := c.cm.nodeMetrics[name]
+	if !ok {
+		return
+	}
+
+	for key := range nm.podMetrics {
+		delete(c.podNodes, key)
+	}
+	c.cm.podCount.current -= nm.podCount.current
+	delete(c.cm.nodeMetrics, name)
+}
+
+// setNamespace includes the pods in a namespace matching the namespace
+// labels. The lock must be held.
+func (c *informerCollector) setNamespace(name string) {
+	if c.namespaces == nil || c.namespaces[name] {
+		return
+	}
+	c.namespaces[name] = true
+	c.forEachPodInNamespace(name, c.setPod)
+}
+
+// deleteNamespace leaves out the pods in a namespace that no longer matches
+// the namespace labels. The lock must be held.
+func (c *informerCollector) deleteNamespace(name string) {
+	if c.namespaces == nil || !c.namespaces[name] {
+		return
+	}
+	delete(c.namespaces, name)
+	c.forEachPodInNamespace(name, func(pod *corev1.Pod) {
+		c.deletePod(podKey(pod))
+	})
+}
+
+func (c *informerCollector) forEachPodInNamespace(namespace string, fn func(*corev1.Pod)) {
+	pods, err := c.podInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		return
+	}
+	for _, obj := range pods {
+		fn(obj.(*corev1.Pod))
+	}
+}
+
+func podKey(pod *corev1.Pod) string {
+	return fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
+}
+
+func podNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// trimPod keeps only the fields of a pod that its metric is built from, to
+// reduce the memory used by the pod cache.
+func trimPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pod.Name,
+			Namespace:         pod.Namespace,
+			UID:               pod.UID,
+			ResourceVersion:   pod.ResourceVersion,
+			CreationTimestamp: pod.CreationTimestamp,
+			Labels:            pod.Labels,
+			OwnerReferences:   pod.OwnerReferences,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:            pod.Spec.NodeName,
+			Containers:          trimContainers(pod.Spec.Containers),
+			InitContainers:      trimContainers(pod.Spec.InitContainers),
+			EphemeralContainers: trimEphemeralContainers(pod.Spec.EphemeralContainers),
+			Overhead:            pod.Spec.Overhead,
+			RuntimeClassName:    pod.Spec.RuntimeClassName,
+		},
+		Status: corev1.PodStatus{
+			Phase:             pod.Status.Phase,
+			Conditions:        trimConditions(pod.Status.Conditions),
+			ContainerStatuses: trimContainerStatuses(pod.Status.ContainerStatuses),
+			Resize:            pod.Status.Resize,
+		},
+	}, nil
+}
+
+// trimContainerStatuses keeps the resources allocated to each container,
+// which pod requests are based on while the pod is being resized.
+func trimContainerStatuses(statuses []corev1.ContainerStatus) []corev1.ContainerStatus {
+	if statuses == nil {
+		return nil
+	}
+
+	trimmed := make([]corev1.ContainerStatus, len(statuses))
+	for i, status := range statuses {
+		trimmed[i] = corev1.ContainerStatus{
+			Name:               status.Name,
+			AllocatedResources: status.AllocatedResources,
+			Resources:          status.Resources,
+		}
+	}
+	return trimmed
+}
+
+// trimConditions keeps only the PodScheduled condition, which explains why a
+// pending pod has not been scheduled.
+func trimConditions(conditions []corev1.PodCondition) []corev1.PodCondition {
+	for _, condition := range conditions {
+		if condition.Type == corev1.PodScheduled {
+			return []corev1.PodCondition{{
+				Type:    condition.Type,
+				Status:  condition.Status,
+				Reason:  condition.Reason,
+				Message: condition.Message,
+			}}
+		}
+	}
+	return nil
+}
+
+func trimContainers(containers []corev1.Container) []corev1.Container {
+	if containers == nil {
+		return nil
+	}
+
+	trimmed := make([]corev1.Container, len(containers))
+	for i, container := range containers {
+		trimmed[i] = corev1.Container{
+			Name:          container.Name,
+			Resources:     container.Resources,
+			RestartPolicy: container.RestartPolicy,
+		}
+	}
+	return trimmed
+}
+
+func trimEphemeralContainers(containers []corev1.EphemeralContainer) []corev1.EphemeralContainer {
+	if containers == nil {
+		return nil
+	}
+
+	trimmed := make([]corev1.EphemeralContainer, len(containers))
+	for i, container := range containers {
+		trimmed[i] = corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Name:      container.Name,
+				Resources: container.Resources,
+			},
+		}
+	}
+	return trimmed
+}
+
+// trimNode keeps only the fields of a node that its metric is built from,
+// leaving out large fields such as the list of images on the node.
+func trimNode(obj interface{}) (interface{}, error) {
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		return obj, nil
+	}
+
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            node.Name,
+			UID:             node.UID,
+			ResourceVersion: node.ResourceVersion,
+			Labels:          node.Labels,
+		},
+		Spec: corev1.NodeSpec{
+			Taints:        node.Spec.Taints,
+			Unschedulable: node.Spec.Unschedulable,
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: node.Status.Allocatable,
+		},
+	}, nil
+}
+
+func trimNamespace(obj interface{}) (interface{}, error) {
+	namespace, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return obj, nil
+	}
+
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            namespace.Name,
+			UID:             namespace.UID,
+			ResourceVersion: namespace.ResourceVersion,
+		},
+	}, nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInformerCollector(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	clientset := fake.NewSimpleClientset(&node1, &web)
+
+	c := startTestCollector(t, Options{Clientset: clientset})
+
+	cpuRequests := func() int64 {
+		cc, err := c.collect(context.TODO())
+		assert.NoError(t, err)
+		return cc.cm.resources["cpu"].request.MilliValue()
+	}
+	assert.Equal(t, int64(200), cpuRequests())
+
+	db := groupTestPod("example-node-1", "default", "db", "300m", "300m")
+	_, err := clientset.CoreV1().Pods("default").Create(context.TODO(), &db, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return cpuRequests() == 500 }, time.Second, 10*time.Millisecond)
+
+	web.Spec.Containers[0].Resources.Requests["cpu"] = resource.MustParse("100m")
+	_, err = clientset.CoreV1().Pods("default").Update(context.TODO(), &web, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return cpuRequests() == 400 }, time.Second, 10*time.Millisecond)
+
+	err = clientset.CoreV1().Pods("default").Delete(context.TODO(), "db", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return cpuRequests() == 100 }, time.Second, 10*time.Millisecond)
+
+	// Pods are added once the node they are scheduled on is.
+	late := groupTestPod("example-node-2", "default", "late", "50m", "50m")
+	_, err = clientset.CoreV1().Pods("default").Create(context.TODO(), &late, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	node2 := groupTestNode("example-node-2")
+	_, err = clientset.CoreV1().Nodes().Create(context.TODO(), &node2, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return cpuRequests() == 150 }, time.Second, 10*time.Millisecond)
+
+	cc, err := c.collect(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cc.cm.podCount.current)
+	assert.Equal(t, int64(2000), cc.cm.resources["cpu"].allocatable.MilliValue())
+
+	// Collecting returns a copy, so printing cannot modify the collector.
+	cc.cm.nodeMetrics["example-node-1"].resources["cpu"].request.Add(resource.MustParse("1"))
+	assert.Equal(t, int64(150), cpuRequests())
+
+	err = clientset.CoreV1().Nodes().Delete(context.TODO(), "example-node-2", metav1.DeleteOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return cpuRequests() == 100 }, time.Second, 10*time.Millisecond)
+}
+
+func TestInformerCollectorNamespaceLabels(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	dns := groupTestPod("example-node-1", "kube-system", "dns", "100m", "100m")
+	clientset := fake.NewSimpleClientset(&node1, &web, &dns,
+		namespace("default", map[string]string{"app": "true"}),
+		namespace("kube-system", nil),
+	)
+
+	c := startTestCollector(t, Options{Clientset: clientset, NamespaceLabels: "app=true"})
+
+	podNames := func() []string {
+		cc, err := c.collect(context.TODO())
+		assert.NoError(t, err)
+		names := []string{}
+		for _, pm := range cc.cm.nodeMetrics["example-node-1"].getSortedPodMetrics("name") {
+			names = append(names, pm.name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"web"}, podNames())
+
+	_, err := clientset.CoreV1().Namespaces().Update(context.TODO(),
+		namespace("kube-system", map[string]string{"app": "true"}), metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(podNames()) == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestInformerCollectorPending(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	queued := pendingTestPod("default", "queued", "300m", time.Now())
+	clientset := fake.NewSimpleClientset(&node1, &queued)
+
+	c := startTestCollector(t, Options{Clientset: clientset, Pending: true})
+
+	cpuRequests := func() (scheduled, pending int64) {
+		cc, err := c.collect(context.TODO())
+		assert.NoError(t, err)
+		return cc.cm.resources["cpu"].request.MilliValue(), cc.cm.pending.resources["cpu"].request.MilliValue()
+	}
+	scheduled, pending := cpuRequests()
+	assert.Equal(t, int64(0), scheduled)
+	assert.Equal(t, int64(300), pending)
+
+	// Once scheduled, the pod moves from pending to its node.
+	queued.Spec.NodeName = "example-node-1"
+	queued.Status = corev1.PodStatus{Phase: corev1.PodRunning}
+	_, err := clientset.CoreV1().Pods("default").Update(context.TODO(), &queued, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		scheduled, pending := cpuRequests()
+		return scheduled == 300 && pending == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTrimPod(t *testing.T) {
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	web.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+	web.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+	web.Spec.Containers[0].Image = "nginx"
+	web.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "HELLO", Value: "world"}}
+	web.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "busybox"}},
+	}
+	always := corev1.ContainerRestartPolicyAlways
+	web.Spec.InitContainers = []corev1.Container{{Name: "proxy", Image: "envoy", RestartPolicy: &always}}
+	web.Status.Phase = corev1.PodRunning
+	web.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:               "web",
+		Image:              "nginx",
+		Ready:              true,
+		AllocatedResources: corev1.ResourceList{"cpu": resource.MustParse("300m")},
+	}}
+	web.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastProbeTime: metav1.Now()},
+	}
+
+	obj, err := trimPod(&web)
+	assert.NoError(t, err)
+	trimmed := obj.(*corev1.Pod)
+
+	assert.Nil(t, trimmed.ManagedFields)
+	assert.Nil(t, trimmed.Annotations)
+	assert.Equal(t, []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}}, trimmed.Status.Conditions)
+	assert.Equal(t, corev1.PodRunning, trimmed.Status.Phase)
+	assert.Equal(t, []corev1.Container{{Name: "web", Resources: web.Spec.Containers[0].Resources}}, trimmed.Spec.Containers)
+	assert.Equal(t, []corev1.Container{{Name: "proxy", RestartPolicy: &always}}, trimmed.Spec.InitContainers)
+	assert.Equal(t, []corev1.ContainerStatus{{
+		Name:               "web",
+		AllocatedResources: corev1.ResourceList{"cpu": resource.MustParse("300m")},
+	}}, trimmed.Status.ContainerStatuses)
+	assert.Equal(t, "debugger", trimmed.Spec.EphemeralContainers[0].Name)
+	assert.Empty(t, trimmed.Spec.EphemeralContainers[0].Image)
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{web}}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}, nil, DefaultResources)
+	trimmedCM := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{*trimmed}}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}, nil, DefaultResources)
+	assert.Equal(t, cm, trimmedCM)
+}
+
+// Informers only keep part of each pod, which must be enough to get the same
+// totals as listing pods.
+func TestInformerCollectorMatchesCollect(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "100m", "400m")
+	// The request was lowered, but the kubelet has not resized the container
+	// yet, so the scheduler still counts what is allocated.
+	web.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:               "web",
+		AllocatedResources: corev1.ResourceList{"cpu": resource.MustParse("300m")},
+	}}
+	always := corev1.ContainerRestartPolicyAlways
+	web.Spec.InitContainers = []corev1.Container{{Name: "proxy", RestartPolicy: &always, Resources: corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{"cpu": resource.MustParse("50m")},
+	}}}
+	web.Spec.Overhead = corev1.ResourceList{"cpu": resource.MustParse("10m")}
+	dns := groupTestPod("example-node-1", "kube-system", "dns", "200m", "200m")
+	clientset := fake.NewSimpleClientset(&node1, &web, &dns)
+
+	listed, err := Collect(context.TODO(), Options{Clientset: clientset})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(560), listed.cm.resources["cpu"].request.MilliValue())
+
+	c := startTestCollector(t, Options{Clientset: clientset})
+	watched, err := c.collect(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, listed.ClusterMetrics(), watched.ClusterMetrics())
+}
+
+func startTestCollector(t *testing.T, opts Options) *informerCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c, err := newInformerCollector(opts)
+	assert.NoError(t, err)
+	assert.NoError(t, c.start(ctx))
+	return c
+}
@@ -17,145 +17,281 @@ package capacity
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"time"
 
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"sigs.k8s.io/yaml"
 )
 
-type listNodeMetric struct {
-	Name     string              `json:"name"`
-	CPU      *listResourceOutput `json:"cpu,omitempty"`
-	Memory   *listResourceOutput `json:"memory,omitempty"`
-	Pods     []*listPod          `json:"pods,omitempty"`
-	PodCount string              `json:"podCount,omitempty"`
+type listPrinter struct {
+	cm               *clusterMetric
+	showPods         bool
+	showContainers   bool
+	showUtil         bool
+	showOverhead     bool
+	showPodCount     bool
+	sortBy           string
+	groupBy          string
+	groupByNodeLabel string
+	outputVersion    string
 }
 
-type listPod struct {
-	Name       string              `json:"name"`
-	Namespace  string              `json:"namespace"`
-	CPU        *listResourceOutput `json:"cpu"`
-	Memory     *listResourceOutput `json:"memory"`
-	Containers []listContainer     `json:"containers,omitempty"`
-}
+func (lp listPrinter) Print(w io.Writer, outputType string) error {
+	listOutput := lp.buildListOutput()
 
-type listContainer struct {
-	Name   string              `json:"name"`
-	CPU    *listResourceOutput `json:"cpu"`
-	Memory *listResourceOutput `json:"memory"`
-}
+	jsonRaw, err := json.MarshalIndent(listOutput, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error Marshalling JSON: %v", err)
+	}
+
+	if outputType == JSONOutput {
+		_, err = fmt.Fprintf(w, "%s", jsonRaw)
+		return err
+	}
 
-type listResourceOutput struct {
-	Requests       string `json:"requests"`
-	RequestsPct    string `json:"requestsPercent"`
-	Limits         string `json:"limits"`
-	LimitsPct      string `json:"limitsPercent"`
-	Utilization    string `json:"utilization,omitempty"`
-	UtilizationPct string `json:"utilizationPercent,omitempty"`
+	// This is a strange approach, but the k8s YAML package
+	// already marshalls to JSON before converting to YAML,
+	// this just allows us to follow the same code path.
+	yamlRaw, err := yaml.JSONToYAML(jsonRaw)
+	if err != nil {
+		return fmt.Errorf("Error Converting JSON to Yaml: %v", err)
+	}
+	_, err = fmt.Fprintf(w, "%s", yamlRaw)
+	return err
 }
 
-type listClusterMetrics struct {
-	Nodes         []*listNodeMetric  `json:"nodes"`
-	ClusterTotals *listClusterTotals `json:"clusterTotals"`
+// buildListOutput returns the structure to marshal for the requested output
+// version, defaulting to v1.
+func (lp *listPrinter) buildListOutput() interface{} {
+	if lp.outputVersion == OutputVersionV2 {
+		return lp.buildListClusterMetricsV2()
+	}
+	return lp.buildListClusterMetrics()
 }
 
-type listClusterTotals struct {
-	CPU      *listResourceOutput `json:"cpu"`
-	Memory   *listResourceOutput `json:"memory"`
-	PodCount string              `json:"podCount,omitempty"`
+func (lp *listPrinter) buildListClusterMetrics() apiv1.ClusterMetrics {
+	// Nodes is always included, and an empty list rather than null when
+	// there are none or the output is grouped.
+	response := apiv1.ClusterMetrics{Nodes: []*apiv1.NodeMetric{}}
+
+	response.ClusterTotals = &apiv1.ClusterTotals{}
+	response.ClusterTotals.CPU, response.ClusterTotals.Memory, response.ClusterTotals.Resources =
+		lp.buildListResources(lp.cm.resources)
+
+	if lp.showPodCount {
+		response.ClusterTotals.PodCount = lp.cm.podCount.podCountString()
+	}
+
+	if lp.showOverhead {
+		for _, rcm := range lp.cm.getSortedRuntimeClassMetrics() {
+			runtimeClass := &apiv1.RuntimeClassMetric{Name: rcm.name, Pods: rcm.podCount}
+			runtimeClass.CPU, runtimeClass.Memory, runtimeClass.Resources = lp.buildListResources(rcm.resources)
+			response.ClusterTotals.RuntimeClasses = append(response.ClusterTotals.RuntimeClasses, runtimeClass)
+		}
+	}
+
+	if lp.cm.pending != nil {
+		response.Pending = lp.buildListPending(lp.cm.pending)
+	}
+
+	if lp.groupBy == WorkloadGrouping {
+		for _, groupMetric := range lp.cm.getSortedGroupMetrics(lp.groupBy, lp.sortBy) {
+			workload := apiv1.WorkloadMetric{
+				Name:      groupMetric.name,
+				Namespace: groupMetric.namespace,
+				Kind:      groupMetric.kind,
+				Replicas:  groupMetric.podCount.current,
+			}
+			workload.CPU, workload.Memory, workload.Resources = lp.buildListResources(groupMetric.resources)
+
+			if lp.showPodCount {
+				workload.PodCount = groupMetric.podCount.podCountString()
+			}
+
+			if lp.showPods || lp.showContainers {
+				workload.Pods = lp.buildListPods(groupMetric.getSortedPodMetrics(lp.sortBy))
+			}
+			response.Workloads = append(response.Workloads, &workload)
+		}
+
+		return response
+	}
+
+	if lp.groupBy == NamespaceGrouping {
+		for _, groupMetric := range lp.cm.getSortedGroupMetrics(lp.groupBy, lp.sortBy) {
+			var ns apiv1.NamespaceMetric
+			ns.Name = groupMetric.name
+			ns.CPU, ns.Memory, ns.Resources = lp.buildListResources(groupMetric.resources)
+
+			if lp.showPodCount {
+				ns.PodCount = groupMetric.podCount.podCountString()
+			}
+
+			if lp.showPods || lp.showContainers {
+				ns.Pods = lp.buildListPods(groupMetric.getSortedPodMetrics(lp.sortBy))
+			}
+			response.Namespaces = append(response.Namespaces, &ns)
+		}
+
+		return response
+	}
+
+	if lp.groupByNodeLabel != "" {
+		for _, nodeGroupMetric := range lp.cm.getSortedNodeGroupMetrics(lp.groupByNodeLabel, lp.sortBy) {
+			nodeGroup := apiv1.NodeGroupMetric{
+				Label: lp.groupByNodeLabel,
+				Value: nodeGroupMetric.name,
+			}
+			nodeGroup.CPU, nodeGroup.Memory, nodeGroup.Resources = lp.buildListResources(nodeGroupMetric.resources)
+
+			if lp.showPodCount {
+				nodeGroup.PodCount = nodeGroupMetric.podCount.podCountString()
+			}
+
+			for _, nodeMetric := range nodeGroupMetric.getSortedNodeMetrics(lp.sortBy) {
+				nodeGroup.Nodes = append(nodeGroup.Nodes, lp.buildListNode(nodeMetric))
+			}
+			response.NodeGroups = append(response.NodeGroups, &nodeGroup)
+		}
+
+		return response
+	}
+
+	for _, nodeMetric := range lp.cm.getSortedNodeMetrics(lp.sortBy) {
+		response.Nodes = append(response.Nodes, lp.buildListNode(nodeMetric))
+	}
+
+	return response
 }
 
-type listPrinter struct {
-	cm             *clusterMetric
-	showPods       bool
-	showContainers bool
-	showUtil       bool
-	showPodCount   bool
-	sortBy         string
+func (lp *listPrinter) buildListNode(nodeMetric *nodeMetric) *apiv1.NodeMetric {
+	var node apiv1.NodeMetric
+	node.Name = nodeMetric.name
+	node.CPU, node.Memory, node.Resources = lp.buildListResources(nodeMetric.resources)
+
+	if lp.showPodCount {
+		node.PodCount = nodeMetric.podCount.podCountString()
+	}
+
+	if lp.showPods || lp.showContainers {
+		node.Pods = lp.buildListPods(nodeMetric.getSortedPodMetrics(lp.sortBy))
+	}
+
+	return &node
 }
 
-func (lp listPrinter) Print(outputType string) {
-	listOutput := lp.buildListClusterMetrics()
+func (lp *listPrinter) buildListPods(podMetrics []*podMetric) []*apiv1.Pod {
+	var pods []*apiv1.Pod
 
-	jsonRaw, err := json.MarshalIndent(listOutput, "", "  ")
-	if err != nil {
-		fmt.Println("Error Marshalling JSON")
-		fmt.Println(err)
-	} else {
-		if outputType == JSONOutput {
-			fmt.Printf("%s", jsonRaw)
-		} else {
-			// This is a strange approach, but the k8s YAML package
-			// already marshalls to JSON before converting to YAML,
-			// this just allows us to follow the same code path.
-			yamlRaw, err := yaml.JSONToYAML(jsonRaw)
-			if err != nil {
-				fmt.Println("Error Converting JSON to Yaml")
-				fmt.Println(err)
-			} else {
-				fmt.Printf("%s", yamlRaw)
-			}
+	for _, podMetric := range podMetrics {
+		var pod apiv1.Pod
+		pod.Name = podMetric.name
+		pod.Namespace = podMetric.namespace
+		pod.CPU, pod.Memory, pod.Resources = lp.buildListResources(podMetric.resources)
+
+		if lp.showContainers {
+			pod.EffectiveRequests = lp.buildListEffectiveRequests(podMetric)
+			pod.Containers = lp.buildListContainers(podMetric)
 		}
+		pods = append(pods, &pod)
 	}
+
+	return pods
 }
 
-func (lp *listPrinter) buildListClusterMetrics() listClusterMetrics {
-	var response listClusterMetrics
+func (lp *listPrinter) buildListContainers(podMetric *podMetric) []apiv1.Container {
+	var containers []apiv1.Container
+	for _, containerMetric := range podMetric.getSortedContainerMetrics(lp.sortBy) {
+		container := apiv1.Container{Name: containerMetric.name, Type: containerMetric.containerType}
+		container.CPU, container.Memory, container.Resources = lp.buildListResources(containerMetric.resources)
+		containers = append(containers, container)
+	}
+	return containers
+}
 
-	response.ClusterTotals = &listClusterTotals{
-		CPU:    lp.buildListResourceOutput(lp.cm.cpu),
-		Memory: lp.buildListResourceOutput(lp.cm.memory),
+func (lp *listPrinter) buildListEffectiveRequests(podMetric *podMetric) map[string]*apiv1.EffectiveRequests {
+	effective := map[string]*apiv1.EffectiveRequests{}
+	for name, rm := range podMetric.resources {
+		rb := podMetric.requestBreakdown(name)
+		format := rm.valueFunction()
+		effective[name] = &apiv1.EffectiveRequests{
+			Containers:     format(rb.containers),
+			Sidecars:       format(rb.sidecars),
+			InitContainers: format(rb.initContainers),
+			Overhead:       format(rb.overhead),
+			Effective:      format(rb.effective),
+		}
 	}
+	return effective
+}
+
+// buildListPending lists every pending pod, with or without pods being shown,
+// since which pods are pending is the point of collecting them.
+func (lp *listPrinter) buildListPending(nodeMetric *nodeMetric) *apiv1.PendingMetric {
+	var pending apiv1.PendingMetric
+	pending.CPU, pending.Memory, pending.Resources = lp.buildListResources(nodeMetric.resources)
 
 	if lp.showPodCount {
-		response.ClusterTotals.PodCount = lp.cm.podCount.podCountString()
+		pending.PodCount = nodeMetric.podCount.podCountString()
 	}
 
-	for _, nodeMetric := range lp.cm.getSortedNodeMetrics(lp.sortBy) {
-		var node listNodeMetric
-		node.Name = nodeMetric.name
-		node.CPU = lp.buildListResourceOutput(nodeMetric.cpu)
-		node.Memory = lp.buildListResourceOutput(nodeMetric.memory)
+	for _, podMetric := range nodeMetric.getSortedPodMetrics(lp.sortBy) {
+		pod := apiv1.PendingPod{
+			Name:      podMetric.name,
+			Namespace: podMetric.namespace,
+			Age:       duration.HumanDuration(time.Since(podMetric.created)),
+			Reason:    podMetric.schedulingReason,
+			Message:   podMetric.schedulingMessage,
+		}
+		pod.CPU, pod.Memory, pod.Resources = lp.buildListResources(podMetric.resources)
 
-		if lp.showPodCount {
-			node.PodCount = nodeMetric.podCount.podCountString()
+		if lp.showContainers {
+			pod.EffectiveRequests = lp.buildListEffectiveRequests(podMetric)
+			pod.Containers = lp.buildListContainers(podMetric)
 		}
+		pending.Pods = append(pending.Pods, &pod)
+	}
+
+	return &pending
+}
 
-		if lp.showPods || lp.showContainers {
-			for _, podMetric := range nodeMetric.getSortedPodMetrics(lp.sortBy) {
-				var pod listPod
-				pod.Name = podMetric.name
-				pod.Namespace = podMetric.namespace
-				pod.CPU = lp.buildListResourceOutput(podMetric.cpu)
-				pod.Memory = lp.buildListResourceOutput(podMetric.memory)
-
-				if lp.showContainers {
-					for _, containerMetric := range podMetric.getSortedContainerMetrics(lp.sortBy) {
-						pod.Containers = append(pod.Containers, listContainer{
-							Name:   containerMetric.name,
-							Memory: lp.buildListResourceOutput(containerMetric.memory),
-							CPU:    lp.buildListResourceOutput(containerMetric.cpu),
-						})
-					}
-				}
-				node.Pods = append(node.Pods, &pod)
+// buildListResources splits resource metrics into the dedicated CPU and
+// memory outputs and a map holding any other resources.
+func (lp *listPrinter) buildListResources(rms resourceMetrics) (cpu, memory *apiv1.ResourceOutput, others map[string]*apiv1.ResourceOutput) {
+	for name, rm := range rms {
+		switch name {
+		case "cpu":
+			cpu = lp.buildListResourceOutput(rm)
+		case "memory":
+			memory = lp.buildListResourceOutput(rm)
+		default:
+			if others == nil {
+				others = map[string]*apiv1.ResourceOutput{}
 			}
+			others[name] = lp.buildListResourceOutput(rm)
 		}
-		response.Nodes = append(response.Nodes, &node)
 	}
-
-	return response
+	return cpu, memory, others
 }
 
-func (lp *listPrinter) buildListResourceOutput(item *resourceMetric) *listResourceOutput {
+func (lp *listPrinter) buildListResourceOutput(item *resourceMetric) *apiv1.ResourceOutput {
 	valueCalculator := item.valueFunction()
 	percentCalculator := item.percentFunction()
 
-	out := listResourceOutput{
+	out := apiv1.ResourceOutput{
 		Requests:    valueCalculator(item.request),
 		RequestsPct: percentCalculator(item.request),
 		Limits:      valueCalculator(item.limit),
 		LimitsPct:   percentCalculator(item.limit),
 	}
 
+	if lp.showOverhead {
+		out.Overhead = valueCalculator(item.overhead)
+		out.OverheadPct = percentCalculator(item.overhead)
+	}
+
 	if lp.showUtil {
 		out.Utilization = valueCalculator(item.utilization)
 		out.UtilizationPct = percentCalculator(item.utilization)
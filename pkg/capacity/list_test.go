@@ -15,13 +15,23 @@
 package capacity
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/robscott/kube-capacity/pkg/api"
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
 	"github.com/stretchr/testify/assert"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
@@ -34,14 +44,14 @@ func TestBuildListClusterMetricsNoOptions(t *testing.T) {
 
 	lcm := lp.buildListClusterMetrics()
 
-	assert.EqualValues(t, &listClusterTotals{
-		CPU: &listResourceOutput{
+	assert.EqualValues(t, &apiv1.ClusterTotals{
+		CPU: &apiv1.ResourceOutput{
 			Requests:    "650m",
 			RequestsPct: "65%",
 			Limits:      "810m",
 			LimitsPct:   "81%",
 		},
-		Memory: &listResourceOutput{
+		Memory: &apiv1.ResourceOutput{
 			Requests:    "410Mi",
 			RequestsPct: "10%",
 			Limits:      "580Mi",
@@ -49,15 +59,15 @@ func TestBuildListClusterMetricsNoOptions(t *testing.T) {
 		},
 	}, lcm.ClusterTotals)
 
-	assert.EqualValues(t, &listNodeMetric{
+	assert.EqualValues(t, &apiv1.NodeMetric{
 		Name: "example-node-1",
-		CPU: &listResourceOutput{
+		CPU: &apiv1.ResourceOutput{
 			Requests:    "650m",
 			RequestsPct: "65%",
 			Limits:      "810m",
 			LimitsPct:   "81%",
 		},
-		Memory: &listResourceOutput{
+		Memory: &apiv1.ResourceOutput{
 			Requests:    "410Mi",
 			RequestsPct: "10%",
 			Limits:      "580Mi",
@@ -80,8 +90,8 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 
 	lcm := lp.buildListClusterMetrics()
 
-	assert.EqualValues(t, &listClusterTotals{
-		CPU: &listResourceOutput{
+	assert.EqualValues(t, &apiv1.ClusterTotals{
+		CPU: &apiv1.ResourceOutput{
 			Requests:       "650m",
 			RequestsPct:    "65%",
 			Limits:         "810m",
@@ -89,7 +99,7 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 			Utilization:    "63m",
 			UtilizationPct: "6%",
 		},
-		Memory: &listResourceOutput{
+		Memory: &apiv1.ResourceOutput{
 			Requests:       "410Mi",
 			RequestsPct:    "10%",
 			Limits:         "580Mi",
@@ -100,10 +110,10 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 		PodCount: "1/110",
 	}, lcm.ClusterTotals)
 
-	assert.EqualValues(t, &listNodeMetric{
+	assert.EqualValues(t, &apiv1.NodeMetric{
 		Name:     "example-node-1",
 		PodCount: "1/110",
-		CPU: &listResourceOutput{
+		CPU: &apiv1.ResourceOutput{
 			Requests:       "650m",
 			RequestsPct:    "65%",
 			Limits:         "810m",
@@ -111,7 +121,7 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 			Utilization:    "63m",
 			UtilizationPct: "6%",
 		},
-		Memory: &listResourceOutput{
+		Memory: &apiv1.ResourceOutput{
 			Requests:       "410Mi",
 			RequestsPct:    "10%",
 			Limits:         "580Mi",
@@ -119,11 +129,11 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 			Utilization:    "439Mi",
 			UtilizationPct: "10%",
 		},
-		Pods: []*listPod{
+		Pods: []*apiv1.Pod{
 			{
 				Name:      "example-pod",
 				Namespace: "default",
-				CPU: &listResourceOutput{
+				CPU: &apiv1.ResourceOutput{
 					Requests:       "650m",
 					RequestsPct:    "65%",
 					Limits:         "810m",
@@ -131,7 +141,7 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 					Utilization:    "63m",
 					UtilizationPct: "6%",
 				},
-				Memory: &listResourceOutput{
+				Memory: &apiv1.ResourceOutput{
 					Requests:       "410Mi",
 					RequestsPct:    "10%",
 					Limits:         "580Mi",
@@ -139,10 +149,15 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 					Utilization:    "439Mi",
 					UtilizationPct: "10%",
 				},
-				Containers: []listContainer{
+				EffectiveRequests: map[string]*apiv1.EffectiveRequests{
+					"cpu":    {Containers: "650m", Sidecars: "0m", InitContainers: "0m", Overhead: "0m", Effective: "650m"},
+					"memory": {Containers: "410Mi", Sidecars: "0Mi", InitContainers: "0Mi", Overhead: "0Mi", Effective: "410Mi"},
+				},
+				Containers: []apiv1.Container{
 					{
 						Name: "example-container-1",
-						CPU: &listResourceOutput{
+						Type: "app",
+						CPU: &apiv1.ResourceOutput{
 							Requests:       "450m",
 							RequestsPct:    "45%",
 							Limits:         "560m",
@@ -150,7 +165,7 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 							Utilization:    "40m",
 							UtilizationPct: "4%",
 						},
-						Memory: &listResourceOutput{
+						Memory: &apiv1.ResourceOutput{
 							Requests:       "160Mi",
 							RequestsPct:    "4%",
 							Limits:         "280Mi",
@@ -160,7 +175,8 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 						},
 					}, {
 						Name: "example-container-2",
-						CPU: &listResourceOutput{
+						Type: "app",
+						CPU: &apiv1.ResourceOutput{
 							Requests:       "200m",
 							RequestsPct:    "20%",
 							Limits:         "250m",
@@ -168,7 +184,7 @@ func TestBuildListClusterMetricsAllOptions(t *testing.T) {
 							Utilization:    "23m",
 							UtilizationPct: "2%",
 						},
-						Memory: &listResourceOutput{
+						Memory: &apiv1.ResourceOutput{
 							Requests:       "250Mi",
 							RequestsPct:    "6%",
 							Limits:         "300Mi",
@@ -277,5 +293,153 @@ func getTestClusterMetric() clusterMetric {
 				},
 			},
 		},
+		DefaultResources,
 	)
 }
+
+func TestListOutputRoundTrip(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	for _, version := range SupportedOutputVersions() {
+		lp := &listPrinter{cm: &cm, showPods: true, showContainers: true, showUtil: true, showPodCount: true,
+			sortBy: "name", outputVersion: version}
+
+		raw, err := json.Marshal(lp.buildListOutput())
+		assert.NoError(t, err)
+
+		var decoded interface{} = &apiv1.ClusterMetrics{}
+		if version == OutputVersionV2 {
+			decoded = &apiv2.ClusterMetrics{}
+		}
+
+		decoder := json.NewDecoder(bytes.NewBuffer(raw))
+		decoder.DisallowUnknownFields()
+		assert.NoError(t, decoder.Decode(decoded), "decoding %s output", version)
+
+		roundTripped, err := json.Marshal(decoded)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(raw), string(roundTripped), "round tripping %s output", version)
+	}
+}
+
+func TestBuildListClusterMetricsNoNodes(t *testing.T) {
+	cm := buildClusterMetric(&corev1.PodList{}, nil, &corev1.NodeList{}, nil, DefaultResources)
+	lp := &listPrinter{cm: &cm, sortBy: "name"}
+
+	raw, err := json.Marshal(lp.buildListOutput())
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"nodes":[]`)
+	assert.NotContains(t, string(raw), `"namespaces"`)
+}
+
+// The JSON output of every grouping, including an empty cluster, must be
+// valid against the published schema of its version.
+func TestListOutputMatchesSchema(t *testing.T) {
+	node1 := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	queued := pendingTestPod("default", "queued", "300m", time.Now())
+
+	full, err := Collect(context.TODO(), Options{Clientset: fake.NewSimpleClientset(&node1, &web, &queued),
+		Pending: true, Workloads: true})
+	assert.NoError(t, err)
+	empty, err := Collect(context.TODO(), Options{Clientset: fake.NewSimpleClientset(), Workloads: true})
+	assert.NoError(t, err)
+
+	for _, version := range SupportedOutputVersions() {
+		raw, err := api.Schema(version)
+		assert.NoError(t, err)
+		var s map[string]interface{}
+		assert.NoError(t, json.Unmarshal(raw, &s))
+
+		for _, opts := range []PrintOptions{
+			{},
+			{ShowPods: true, ShowContainers: true, ShowPodCount: true, ShowOverhead: true},
+			{GroupBy: NamespaceGrouping, ShowPods: true},
+			{GroupBy: WorkloadGrouping, ShowPods: true},
+			{GroupByNodeLabel: corev1.LabelHostname, ShowPodCount: true},
+		} {
+			opts.Output, opts.OutputVersion = JSONOutput, version
+			p, err := NewPrinter(opts)
+			assert.NoError(t, err)
+
+			for _, cc := range []*ClusterCapacity{full, empty} {
+				var buf bytes.Buffer
+				assert.NoError(t, p.Print(&buf, cc))
+				var out interface{}
+				assert.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+				assert.Empty(t, validateSchema(s, s, out, "$"), "%s output with %+v", version, opts)
+			}
+		}
+	}
+}
+
+// validateSchema returns where a value does not match the subset of JSON
+// Schema the api package generates.
+func validateSchema(root, s map[string]interface{}, v interface{}, path string) []string {
+	if ref, ok := s["$ref"].(string); ok {
+		defs := root["$defs"].(map[string]interface{})
+		return validateSchema(root, defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{}), v, path)
+	}
+
+	var actual string
+	switch v := v.(type) {
+	case nil:
+		actual = "null"
+	case bool:
+		actual = "boolean"
+	case string:
+		actual = "string"
+	case float64:
+		actual = "number"
+		if v == float64(int64(v)) {
+			actual = "integer"
+		}
+	case []interface{}:
+		actual = "array"
+	case map[string]interface{}:
+		actual = "object"
+	}
+
+	allowed := []string{}
+	switch t := s["type"].(type) {
+	case string:
+		allowed = append(allowed, t)
+	case []interface{}:
+		for _, name := range t {
+			allowed = append(allowed, name.(string))
+		}
+	}
+	if containsResource(allowed, "number") {
+		allowed = append(allowed, "integer")
+	}
+	if !containsResource(allowed, actual) {
+		return []string{fmt.Sprintf("%s: %s is not one of %v", path, actual, allowed)}
+	}
+
+	problems := []string{}
+	switch v := v.(type) {
+	case []interface{}:
+		for i, item := range v {
+			problems = append(problems, validateSchema(root, s["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case map[string]interface{}:
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s.%s: missing", path, name))
+				}
+			}
+		}
+		properties, _ := s["properties"].(map[string]interface{})
+		for key, value := range v {
+			if property, ok := properties[key]; ok {
+				problems = append(problems, validateSchema(root, property.(map[string]interface{}), value, path+"."+key)...)
+			} else if additional, ok := s["additionalProperties"].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(root, additional, value, path+"."+key)...)
+			} else {
+				problems = append(problems, fmt.Sprintf("%s.%s: unknown property", path, key))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"math"
+	"time"
+
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	//OutputVersionV1 is the default structured output with preformatted values
+	OutputVersionV1 string = apiv1.Version
+	//OutputVersionV2 is the structured output with numeric values
+	OutputVersionV2 string = apiv2.Version
+)
+
+// SupportedOutputVersions returns the versions of JSON and YAML output
+// supported by this package
+func SupportedOutputVersions() []string {
+	return []string{
+		OutputVersionV1,
+		OutputVersionV2,
+	}
+}
+
+func (lp *listPrinter) buildListClusterMetricsV2() apiv2.ClusterMetrics {
+	response := apiv2.ClusterMetrics{
+		Version: OutputVersionV2,
+		ClusterTotals: &apiv2.ClusterTotals{
+			Resources: lp.buildListResourcesV2(lp.cm.resources),
+			PodCount:  lp.buildListPodCountV2(lp.cm.podCount),
+		},
+	}
+
+	if lp.showOverhead {
+		for _, rcm := range lp.cm.getSortedRuntimeClassMetrics() {
+			response.ClusterTotals.RuntimeClasses = append(response.ClusterTotals.RuntimeClasses, &apiv2.RuntimeClassMetric{
+				Name:      rcm.name,
+				Pods:      rcm.podCount,
+				Resources: lp.buildListResourcesV2(rcm.resources),
+			})
+		}
+	}
+
+	if lp.cm.pending != nil {
+		response.Pending = lp.buildListPendingV2(lp.cm.pending)
+	}
+
+	if lp.groupBy == WorkloadGrouping {
+		for _, groupMetric := range lp.cm.getSortedGroupMetrics(lp.groupBy, lp.sortBy) {
+			response.Workloads = append(response.Workloads, &apiv2.WorkloadMetric{
+				Name:      groupMetric.name,
+				Namespace: groupMetric.namespace,
+				Kind:      groupMetric.kind,
+				Replicas:  groupMetric.podCount.current,
+				Resources: lp.buildListResourcesV2(groupMetric.resources),
+				Pods:      lp.buildListPodsV2(groupMetric.getSortedPodMetrics(lp.sortBy)),
+				PodCount:  lp.buildListPodCountV2(groupMetric.podCount),
+			})
+		}
+
+		return response
+	}
+
+	if lp.groupBy == NamespaceGrouping {
+		for _, groupMetric := range lp.cm.getSortedGroupMetrics(lp.groupBy, lp.sortBy) {
+			response.Namespaces = append(response.Namespaces, &apiv2.NamespaceMetric{
+				Name:      groupMetric.name,
+				Resources: lp.buildListResourcesV2(groupMetric.resources),
+				Pods:      lp.buildListPodsV2(groupMetric.getSortedPodMetrics(lp.sortBy)),
+				PodCount:  lp.buildListPodCountV2(groupMetric.podCount),
+			})
+		}
+
+		return response
+	}
+
+	if lp.groupByNodeLabel != "" {
+		for _, nodeGroupMetric := range lp.cm.getSortedNodeGroupMetrics(lp.groupByNodeLabel, lp.sortBy) {
+			nodeGroup := &apiv2.NodeGroupMetric{
+				Label:     lp.groupByNodeLabel,
+				Value:     nodeGroupMetric.name,
+				Resources: lp.buildListResourcesV2(nodeGroupMetric.resources),
+				Nodes:     []*apiv2.NodeMetric{},
+				PodCount:  lp.buildListPodCountV2(nodeGroupMetric.podCount),
+			}
+
+			for _, nodeMetric := range nodeGroupMetric.getSortedNodeMetrics(lp.sortBy) {
+				nodeGroup.Nodes = append(nodeGroup.Nodes, lp.buildListNodeV2(nodeMetric))
+			}
+			response.NodeGroups = append(response.NodeGroups, nodeGroup)
+		}
+
+		return response
+	}
+
+	for _, nodeMetric := range lp.cm.getSortedNodeMetrics(lp.sortBy) {
+		response.Nodes = append(response.Nodes, lp.buildListNodeV2(nodeMetric))
+	}
+
+	return response
+}
+
+func (lp *listPrinter) buildListNodeV2(nodeMetric *nodeMetric) *apiv2.NodeMetric {
+	return &apiv2.NodeMetric{
+		Name:      nodeMetric.name,
+		Resources: lp.buildListResourcesV2(nodeMetric.resources),
+		Pods:      lp.buildListPodsV2(nodeMetric.getSortedPodMetrics(lp.sortBy)),
+		PodCount:  lp.buildListPodCountV2(nodeMetric.podCount),
+	}
+}
+
+func (lp *listPrinter) buildListPodsV2(podMetrics []*podMetric) []*apiv2.Pod {
+	if !lp.showPods && !lp.showContainers {
+		return nil
+	}
+
+	var pods []*apiv2.Pod
+	for _, podMetric := range podMetrics {
+		pod := &apiv2.Pod{
+			Name:      podMetric.name,
+			Namespace: podMetric.namespace,
+			Resources: lp.buildListResourcesV2(podMetric.resources),
+		}
+
+		if lp.showContainers {
+			pod.EffectiveRequests = lp.buildListEffectiveRequestsV2(podMetric)
+			pod.Containers = lp.buildListContainersV2(podMetric)
+		}
+		pods = append(pods, pod)
+	}
+
+	return pods
+}
+
+// buildListPendingV2 lists every pending pod, like buildListPending.
+func (lp *listPrinter) buildListPendingV2(nodeMetric *nodeMetric) *apiv2.PendingMetric {
+	pending := &apiv2.PendingMetric{
+		Resources: lp.buildListResourcesV2(nodeMetric.resources),
+		PodCount:  lp.buildListPodCountV2(nodeMetric.podCount),
+	}
+
+	for _, podMetric := range nodeMetric.getSortedPodMetrics(lp.sortBy) {
+		pod := &apiv2.PendingPod{
+			Name:       podMetric.name,
+			Namespace:  podMetric.namespace,
+			AgeSeconds: int64(time.Since(podMetric.created).Seconds()),
+			Reason:     podMetric.schedulingReason,
+			Message:    podMetric.schedulingMessage,
+			Resources:  lp.buildListResourcesV2(podMetric.resources),
+		}
+
+		if lp.showContainers {
+			pod.EffectiveRequests = lp.buildListEffectiveRequestsV2(podMetric)
+			pod.Containers = lp.buildListContainersV2(podMetric)
+		}
+		pending.Pods = append(pending.Pods, pod)
+	}
+
+	return pending
+}
+
+func (lp *listPrinter) buildListContainersV2(podMetric *podMetric) []*apiv2.Container {
+	var containers []*apiv2.Container
+	for _, containerMetric := range podMetric.getSortedContainerMetrics(lp.sortBy) {
+		containers = append(containers, &apiv2.Container{
+			Name:      containerMetric.name,
+			Type:      containerMetric.containerType,
+			Resources: lp.buildListResourcesV2(containerMetric.resources),
+		})
+	}
+	return containers
+}
+
+func (lp *listPrinter) buildListEffectiveRequestsV2(podMetric *podMetric) map[string]*apiv2.EffectiveRequests {
+	effective := map[string]*apiv2.EffectiveRequests{}
+	for name := range podMetric.resources {
+		rb := podMetric.requestBreakdown(name)
+		effective[name] = &apiv2.EffectiveRequests{
+			Containers:     rawValue(name, rb.containers),
+			Sidecars:       rawValue(name, rb.sidecars),
+			InitContainers: rawValue(name, rb.initContainers),
+			Overhead:       rawValue(name, rb.overhead),
+			Effective:      rawValue(name, rb.effective),
+		}
+	}
+	return effective
+}
+
+func (lp *listPrinter) buildListPodCountV2(pc *podCount) *apiv2.PodCount {
+	if !lp.showPodCount {
+		return nil
+	}
+	return &apiv2.PodCount{Current: pc.current, Allocatable: pc.allocatable}
+}
+
+func (lp *listPrinter) buildListResourcesV2(rms resourceMetrics) map[string]*apiv2.ResourceOutput {
+	resources := map[string]*apiv2.ResourceOutput{}
+	for name, rm := range rms {
+		resources[name] = lp.buildListResourceOutputV2(rm)
+	}
+	return resources
+}
+
+func (lp *listPrinter) buildListResourceOutputV2(rm *resourceMetric) *apiv2.ResourceOutput {
+	out := &apiv2.ResourceOutput{
+		Unit:            rawUnit(rm.resourceType),
+		Allocatable:     rawValue(rm.resourceType, rm.allocatable),
+		Requests:        rawValue(rm.resourceType, rm.request),
+		RequestsPercent: percentFloat(rm.request, rm.allocatable),
+		Limits:          rawValue(rm.resourceType, rm.limit),
+		LimitsPercent:   percentFloat(rm.limit, rm.allocatable),
+	}
+
+	if lp.showOverhead {
+		overhead := rawValue(rm.resourceType, rm.overhead)
+		overheadPercent := percentFloat(rm.overhead, rm.allocatable)
+		out.Overhead = &overhead
+		out.OverheadPercent = &overheadPercent
+	}
+
+	if lp.showUtil {
+		utilization := rawValue(rm.resourceType, rm.utilization)
+		utilizationPercent := percentFloat(rm.utilization, rm.allocatable)
+		out.Utilization = &utilization
+		out.UtilizationPercent = &utilizationPercent
+	}
+
+	return out
+}
+
+// percentFloat returns actual as a percentage of allocatable, rounded to two
+// decimal places.
+func percentFloat(actual, allocatable resource.Quantity) float64 {
+	if allocatable.MilliValue() == 0 {
+		return 0
+	}
+	percent := float64(actual.MilliValue()) / float64(allocatable.MilliValue()) * 100
+	return math.Round(percent*100) / 100
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
+	apiv2 "github.com/robscott/kube-capacity/pkg/api/v2"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestBuildListClusterMetricsV2(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+	lp := &listPrinter{cm: &cm, showPods: true, showUtil: true, showPodCount: true, sortBy: "name", outputVersion: OutputVersionV2}
+
+	lcm := lp.buildListOutput().(apiv2.ClusterMetrics)
+
+	assert.Equal(t, OutputVersionV2, lcm.Version)
+	assert.Len(t, lcm.Nodes, 2)
+
+	utilization := int64(0)
+	utilizationPercent := float64(0)
+	assert.Equal(t, &apiv2.ResourceOutput{
+		Unit:               "millicores",
+		Allocatable:        2000,
+		Requests:           900,
+		RequestsPercent:    45,
+		Limits:             1300,
+		LimitsPercent:      65,
+		Utilization:        &utilization,
+		UtilizationPercent: &utilizationPercent,
+	}, lcm.ClusterTotals.Resources["cpu"])
+	assert.Equal(t, int64(2*4000*1024*1024), lcm.ClusterTotals.Resources["memory"].Allocatable)
+	assert.Equal(t, "bytes", lcm.ClusterTotals.Resources["memory"].Unit)
+	assert.Equal(t, &apiv2.PodCount{Current: 3, Allocatable: 220}, lcm.ClusterTotals.PodCount)
+
+	node := lcm.Nodes[0]
+	assert.Equal(t, "example-node-1", node.Name)
+	assert.Equal(t, int64(500), node.Resources["cpu"].Requests)
+	assert.Equal(t, float64(50), node.Resources["cpu"].RequestsPercent)
+	assert.Equal(t, int64(1000), node.Resources["cpu"].Allocatable)
+
+	assert.Len(t, node.Pods, 2)
+	assert.Equal(t, "dns", node.Pods[0].Name)
+	assert.Equal(t, int64(300), node.Pods[0].Resources["cpu"].Requests)
+	assert.Equal(t, int64(1000), node.Pods[0].Resources["cpu"].Allocatable)
+
+	jsonRaw, err := json.Marshal(lcm.ClusterTotals.Resources["cpu"])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"unit":"millicores","allocatable":2000,"requests":900,"requestsPercent":45,
+		"limits":1300,"limitsPercent":65,"utilization":0,"utilizationPercent":0}`, string(jsonRaw))
+}
+
+func TestBuildListOutputDefaultsToV1(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+	lp := &listPrinter{cm: &cm, sortBy: "name"}
+
+	lcm, ok := lp.buildListOutput().(apiv1.ClusterMetrics)
+	assert.True(t, ok)
+	assert.Equal(t, "900m", lcm.ClusterTotals.CPU.Requests)
+}
+
+func TestPercentFloat(t *testing.T) {
+	assert.Equal(t, 33.33, percentFloat(resource.MustParse("1"), resource.MustParse("3")))
+	assert.Equal(t, 150.0, percentFloat(resource.MustParse("1500m"), resource.MustParse("1")))
+	assert.Equal(t, 0.0, percentFloat(resource.MustParse("1"), resource.MustParse("0")))
+}
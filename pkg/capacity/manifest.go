@@ -0,0 +1,165 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
+)
+
+// manifestWorkload is a workload read from a manifest along with the number
+// of pods it runs and the shape of those pods.
+type manifestWorkload struct {
+	ref       workloadRef
+	namespace string
+	replicas  int64
+	shape     *podShape
+}
+
+// readManifestWorkloads reads the workloads defined in a YAML or JSON file,
+// which may contain multiple documents. A filename of "-" reads from stdin.
+func readManifestWorkloads(filename string) ([]*manifestWorkload, error) {
+	var r io.Reader
+	if filename == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return parseManifestWorkloads(r)
+}
+
+func parseManifestWorkloads(r io.Reader) ([]*manifestWorkload, error) {
+	workloads := []*manifestWorkload{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	decoder := scheme.Codecs.UniversalDeserializer()
+
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, gvk, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding manifest: %v", err)
+		}
+
+		var workload *manifestWorkload
+		switch o := obj.(type) {
+		case *appsv1.Deployment:
+			workload = newManifestWorkload(gvk.Kind, o.Name, o.Namespace, replicasOrDefault(o.Spec.Replicas), &o.Spec.Template)
+		case *appsv1.StatefulSet:
+			workload = newManifestWorkload(gvk.Kind, o.Name, o.Namespace, replicasOrDefault(o.Spec.Replicas), &o.Spec.Template)
+		case *appsv1.ReplicaSet:
+			workload = newManifestWorkload(gvk.Kind, o.Name, o.Namespace, replicasOrDefault(o.Spec.Replicas), &o.Spec.Template)
+		case *batchv1.Job:
+			workload = newManifestWorkload(gvk.Kind, o.Name, o.Namespace, replicasOrDefault(o.Spec.Parallelism), &o.Spec.Template)
+		case *corev1.Pod:
+			workload = newManifestWorkload(gvk.Kind, o.Name, o.Namespace, 1,
+				&corev1.PodTemplateSpec{ObjectMeta: o.ObjectMeta, Spec: o.Spec})
+		default:
+			return nil, fmt.Errorf("Unsupported kind %s, only Deployment, StatefulSet, ReplicaSet, Job and Pod are supported", gvk.Kind)
+		}
+
+		workloads = append(workloads, workload)
+	}
+
+	if len(workloads) == 0 {
+		return nil, fmt.Errorf("No workloads found in manifest")
+	}
+
+	return workloads, nil
+}
+
+func replicasOrDefault(replicas *int32) int64 {
+	if replicas == nil {
+		return 1
+	}
+	return int64(*replicas)
+}
+
+func newManifestWorkload(kind, name, namespace string, replicas int64, template *corev1.PodTemplateSpec) *manifestWorkload {
+	// Manifests without a namespace are usually applied to the default one.
+	shapeNamespace := namespace
+	if shapeNamespace == "" {
+		shapeNamespace = metav1.NamespaceDefault
+	}
+
+	return &manifestWorkload{
+		ref:       workloadRef{kind: kind, name: name},
+		namespace: namespace,
+		replicas:  replicas,
+		shape:     newPodShapeFromSpec(shapeNamespace, template.Labels, &template.Spec),
+	}
+}
+
+// newPodShapeFromSpec returns the shape of pods created from a pod spec. The
+// effective requests account for init containers and pod overhead the same
+// way the scheduler does. The namespace and labels of the pods are needed to
+// check required pod affinity, anti-affinity and topology spread constraints.
+func newPodShapeFromSpec(namespace string, podLabels map[string]string, spec *corev1.PodSpec) *podShape {
+	reqs, _ := resourcehelper.PodRequestsAndLimits(&corev1.Pod{Spec: *spec})
+
+	shape := &podShape{
+		requests:       corev1.ResourceList{},
+		nodeSelector:   spec.NodeSelector,
+		tolerations:    spec.Tolerations,
+		nodeName:       spec.NodeName,
+		namespace:      namespace,
+		labels:         podLabels,
+		topologySpread: newTopologySpreads(spec.TopologySpreadConstraints, podLabels),
+	}
+
+	for name, q := range reqs {
+		if !q.IsZero() {
+			shape.requests[name] = q
+		}
+	}
+
+	if spec.Affinity != nil && spec.Affinity.NodeAffinity != nil {
+		shape.requiredNodeAffinity = spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	}
+	if spec.Affinity != nil && spec.Affinity.PodAffinity != nil {
+		shape.podAffinity = newPodAffinityTerms(spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, namespace)
+	}
+	if spec.Affinity != nil && spec.Affinity.PodAntiAffinity != nil {
+		shape.podAntiAffinity = newPodAffinityTerms(spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, namespace)
+	}
+
+	return shape
+}
@@ -0,0 +1,309 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      affinity:
+        nodeAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+            nodeSelectorTerms:
+            - matchExpressions:
+              - key: disktype
+                operator: In
+                values: [ssd]
+      containers:
+      - name: web
+        image: nginx
+        resources:
+          requests:
+            cpu: 300m
+            memory: 256Mi
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+spec:
+  containers:
+  - name: debug
+    image: busybox
+    resources:
+      requests:
+        cpu: 100m
+`
+
+func TestParseManifestWorkloads(t *testing.T) {
+	workloads, err := parseManifestWorkloads(strings.NewReader(testManifest))
+	assert.NoError(t, err)
+	assert.Len(t, workloads, 2)
+
+	assert.Equal(t, "Deployment/web", workloads[0].ref.String())
+	assert.Equal(t, "default", workloads[0].namespace)
+	assert.Equal(t, int64(3), workloads[0].replicas)
+	assert.Equal(t, resource.MustParse("300m"), workloads[0].shape.requests["cpu"])
+	assert.Equal(t, resource.MustParse("256Mi"), workloads[0].shape.requests["memory"])
+	assert.NotNil(t, workloads[0].shape.requiredNodeAffinity)
+
+	assert.Equal(t, "Pod/debug", workloads[1].ref.String())
+	assert.Equal(t, int64(1), workloads[1].replicas)
+	assert.Len(t, workloads[1].shape.requests, 1)
+
+	_, err = parseManifestWorkloads(strings.NewReader("apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"))
+	assert.Error(t, err)
+
+	_, err = parseManifestWorkloads(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestNodeSelectorMatches(t *testing.T) {
+	nm := &nodeMetric{
+		name:   "example-node-1",
+		labels: map[string]string{"disktype": "ssd", "cores": "8"},
+	}
+
+	var testCases = []struct {
+		name     string
+		term     corev1.NodeSelectorTerm
+		expected bool
+	}{
+		{
+			name: "in",
+			term: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "disktype", Operator: corev1.NodeSelectorOpIn, Values: []string{"ssd", "nvme"}},
+			}},
+			expected: true,
+		}, {
+			name: "not in",
+			term: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "disktype", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"ssd"}},
+			}},
+			expected: false,
+		}, {
+			name: "does not exist",
+			term: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "gpu", Operator: corev1.NodeSelectorOpDoesNotExist},
+			}},
+			expected: true,
+		}, {
+			name: "greater than",
+			term: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: "cores", Operator: corev1.NodeSelectorOpGt, Values: []string{"4"}},
+			}},
+			expected: true,
+		}, {
+			name: "node name field",
+			term: corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{
+				{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"example-node-2"}},
+			}},
+			expected: false,
+		}, {
+			name:     "empty term",
+			term:     corev1.NodeSelectorTerm{},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selector := &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{tc.term}}
+			assert.Equal(t, tc.expected, nodeSelectorMatches(selector, nm))
+		})
+	}
+}
+
+func TestPlaceWorkloads(t *testing.T) {
+	ssd := groupTestNode("ssd-1")
+	ssd.Labels = map[string]string{"disktype": "ssd"}
+	ssd2 := groupTestNode("ssd-2")
+	ssd2.Labels = map[string]string{"disktype": "ssd"}
+	hdd := groupTestNode("hdd-1")
+
+	cm := buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				groupTestPod("ssd-1", "default", "api", "500m", "500m"),
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{ssd, ssd2, hdd},
+		}, nil, DefaultResources,
+	)
+
+	workloads, err := parseManifestWorkloads(strings.NewReader(testManifest))
+	assert.NoError(t, err)
+	workloads[0].replicas = 5
+
+	placements := cm.placeWorkloads(workloads)
+	assert.Len(t, placements, 2)
+
+	assert.Equal(t, int64(4), placements[0].placed)
+	assert.Equal(t, map[string]int64{"ssd-1": 1, "ssd-2": 3}, placements[0].nodes)
+	assert.Equal(t, "0/3 nodes available: 1 node affinity does not match, 2 insufficient cpu", placements[0].reason)
+
+	assert.Equal(t, int64(1), placements[1].placed)
+	assert.Equal(t, map[string]int64{"hdd-1": 1}, placements[1].nodes)
+	assert.Equal(t, "", placements[1].reason)
+}
+
+const testTopologyManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: cache
+  namespace: default
+spec:
+  replicas: 5
+  selector:
+    matchLabels:
+      app: cache
+  template:
+    metadata:
+      labels:
+        app: cache
+    spec:
+      affinity:
+        podAntiAffinity:
+          requiredDuringSchedulingIgnoredDuringExecution:
+          - topologyKey: kubernetes.io/hostname
+            labelSelector:
+              matchLabels:
+                app: cache
+      containers:
+      - name: cache
+        image: redis
+        resources:
+          requests:
+            cpu: 100m
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  replicas: 4
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      topologySpreadConstraints:
+      - maxSkew: 1
+        topologyKey: topology.kubernetes.io/zone
+        whenUnsatisfiable: DoNotSchedule
+        labelSelector:
+          matchLabels:
+            app: web
+      containers:
+      - name: web
+        image: nginx
+        resources:
+          requests:
+            cpu: 100m
+`
+
+func TestPlaceWorkloadsTopology(t *testing.T) {
+	nodes := []corev1.Node{}
+	for name, zone := range map[string]string{"node-a": "zone-a", "node-b": "zone-a", "node-c": "zone-b"} {
+		node := groupTestNode(name)
+		node.Labels = map[string]string{corev1.LabelTopologyZone: zone}
+		nodes = append(nodes, node)
+	}
+
+	existing := groupTestPod("node-c", "default", "cache-0", "100m", "100m")
+	existing.Labels = map[string]string{"app": "cache"}
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{existing}}, nil,
+		&corev1.NodeList{Items: nodes}, nil, DefaultResources)
+
+	workloads, err := parseManifestWorkloads(strings.NewReader(testTopologyManifest))
+	assert.NoError(t, err)
+	assert.Len(t, workloads[0].shape.podAntiAffinity, 1)
+	assert.Len(t, workloads[1].shape.topologySpread, 1)
+
+	placements := cm.placeWorkloads(workloads)
+
+	// Only one replica fits on each node, and one is already running.
+	assert.Equal(t, int64(2), placements[0].placed)
+	assert.Equal(t, map[string]int64{"node-a": 1, "node-b": 1}, placements[0].nodes)
+	assert.Equal(t, "0/3 nodes available: 3 pod anti-affinity does not match", placements[0].reason)
+
+	// Replicas are spread evenly across zones rather than across nodes.
+	assert.Equal(t, int64(4), placements[1].placed)
+	assert.Equal(t, map[string]int64{"node-a": 1, "node-b": 1, "node-c": 2}, placements[1].nodes)
+}
+
+func TestPlaceWorkloadsExistingAntiAffinity(t *testing.T) {
+	nodes := []corev1.Node{}
+	for name, zone := range map[string]string{"node-a": "zone-a", "node-b": "zone-a", "node-c": "zone-b"} {
+		node := groupTestNode(name)
+		node.Labels = map[string]string{corev1.LabelTopologyZone: zone}
+		nodes = append(nodes, node)
+	}
+
+	// The batch pod keeps web pods out of its zone, even though the web pods
+	// have no constraints of their own.
+	batch := groupTestPod("node-a", "default", "batch", "100m", "100m")
+	batch.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			TopologyKey:   corev1.LabelTopologyZone,
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+		}},
+	}}
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{batch}}, nil,
+		&corev1.NodeList{Items: nodes}, nil, DefaultResources)
+
+	web := groupTestPod("", "default", "web", "300m", "300m")
+	web.Labels = map[string]string{"app": "web"}
+	workload := newManifestWorkload("Deployment", "web", "default", 4, &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: web.Labels},
+		Spec:       web.Spec,
+	})
+
+	placements := cm.placeWorkloads([]*manifestWorkload{workload})
+	assert.Equal(t, int64(3), placements[0].placed)
+	assert.Equal(t, map[string]int64{"node-c": 3}, placements[0].nodes)
+	assert.Equal(t, "0/3 nodes available: 1 insufficient cpu, 2 existing pod anti-affinity does not match",
+		placements[0].reason)
+}
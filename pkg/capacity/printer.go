@@ -16,7 +16,7 @@ package capacity
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"text/tabwriter"
 )
 
@@ -27,6 +27,14 @@ const (
 	JSONOutput string = "json"
 	//YAMLOutput is the constant value for output type YAML
 	YAMLOutput string = "yaml"
+	//CSVOutput is the constant value for output type CSV
+	CSVOutput string = "csv"
+	//TSVOutput is the constant value for output type TSV
+	TSVOutput string = "tsv"
+	//MarkdownOutput is the constant value for output type Markdown
+	MarkdownOutput string = "markdown"
+	//HTMLOutput is the constant value for output type HTML
+	HTMLOutput string = "html"
 )
 
 // SupportedOutputs returns a string list of output formats supposed by this package
@@ -35,35 +43,182 @@ func SupportedOutputs() []string {
 		TableOutput,
 		JSONOutput,
 		YAMLOutput,
+		CSVOutput,
+		TSVOutput,
+		MarkdownOutput,
+		HTMLOutput,
 	}
 }
 
-func printList(cm *clusterMetric, showContainers, showPods, showUtil, showPodCount, showNamespace bool, output, sortBy string, availableFormat bool) {
-	if output == JSONOutput || output == YAMLOutput {
-		lp := &listPrinter{
+func isCustomColumnsOutput(format string) bool {
+	return format == CustomColumnsOutput || format == CustomColumnsFileOutput
+}
+
+// Printer writes the capacity collected from a cluster in an output format.
+type Printer interface {
+	Print(w io.Writer, cc *ClusterCapacity) error
+}
+
+// PrintOptions configures the output of a Printer. Output defaults to table,
+// SortBy to name and GroupBy to node. Utilization is only shown if it was
+// collected.
+type PrintOptions struct {
+	Output           string
+	OutputVersion    string
+	SortBy           string
+	GroupBy          string
+	GroupByNodeLabel string
+	ShowPods         bool
+	ShowContainers   bool
+	ShowUtil         bool
+	ShowOverhead     bool
+	ShowPodCount     bool
+	AvailableFormat  bool
+}
+
+// outputPrinter prints in any of the supported output formats.
+type outputPrinter struct {
+	opts    PrintOptions
+	columns []*customColumn
+}
+
+// NewPrinter returns a Printer for the output format in the options. It
+// returns an error if the output format is not supported or, for custom
+// columns, if the columns are invalid.
+func NewPrinter(opts PrintOptions) (Printer, error) {
+	return newOutputPrinter(opts)
+}
+
+func newOutputPrinter(opts PrintOptions) (*outputPrinter, error) {
+	if opts.Output == "" {
+		opts.Output = TableOutput
+	}
+	if opts.SortBy == "" {
+		opts.SortBy = "name"
+	}
+	if opts.GroupBy == "" {
+		opts.GroupBy = NodeGrouping
+	}
+
+	op := &outputPrinter{opts: opts}
+
+	if format, arg, ok := ParseTemplateOutput(opts.Output); ok {
+		if isCustomColumnsOutput(format) {
+			columns, err := parseCustomColumnsOutput(format, arg)
+			if err != nil {
+				return nil, err
+			}
+			op.columns = columns
+		}
+		return op, nil
+	}
+
+	for _, output := range SupportedOutputs() {
+		if output == opts.Output {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("Called with an unsupported output type: %s", opts.Output)
+}
+
+// resourceNames adds any resources the output needs to those to collect.
+func (op *outputPrinter) resourceNames(resourceNames []string) []string {
+	if op.columns == nil {
+		return resourceNames
+	}
+	return customColumnsResourceNames(resourceNames, op.columns)
+}
+
+func (op *outputPrinter) Print(w io.Writer, cc *ClusterCapacity) error {
+	opts := op.printOptions(cc)
+	cm := &cc.cm
+
+	if opts.GroupBy == WorkloadGrouping && !cc.options.Workloads {
+		return fmt.Errorf("Grouping by %s requires workloads to be collected", WorkloadGrouping)
+	}
+
+	if op.columns != nil {
+		cp := &customColumnsPrinter{
 			cm:             cm,
-			showPods:       showPods,
-			showUtil:       showUtil,
-			showContainers: showContainers,
-			showPodCount:   showPodCount,
-			sortBy:         sortBy,
+			columns:        op.columns,
+			showPods:       opts.ShowPods,
+			showContainers: opts.ShowContainers,
+			sortBy:         opts.SortBy,
 		}
-		lp.Print(output)
-	} else if output == TableOutput {
-		tp := &tablePrinter{
-			cm:              cm,
-			showPods:        showPods,
-			showUtil:        showUtil,
-			showPodCount:    showPodCount,
-			showContainers:  showContainers,
-			showNamespace:   showNamespace,
-			sortBy:          sortBy,
-			w:               new(tabwriter.Writer),
-			availableFormat: availableFormat,
+		return cp.Print(w)
+	}
+
+	lp := &listPrinter{
+		cm:               cm,
+		showPods:         opts.ShowPods,
+		showUtil:         opts.ShowUtil,
+		showOverhead:     opts.ShowOverhead,
+		showContainers:   opts.ShowContainers,
+		showPodCount:     opts.ShowPodCount,
+		sortBy:           opts.SortBy,
+		groupBy:          opts.GroupBy,
+		groupByNodeLabel: opts.GroupByNodeLabel,
+		outputVersion:    opts.OutputVersion,
+	}
+
+	if format, arg, ok := ParseTemplateOutput(opts.Output); ok {
+		tp := &templatePrinter{lp: lp, format: format, arg: arg}
+		return tp.Print(w)
+	}
+
+	switch opts.Output {
+	case JSONOutput, YAMLOutput:
+		return lp.Print(w, opts.Output)
+	case CSVOutput, TSVOutput:
+		cp := &csvPrinter{
+			cm:             cm,
+			showPods:       opts.ShowPods,
+			showContainers: opts.ShowContainers,
+			showUtil:       opts.ShowUtil,
+			showPodCount:   opts.ShowPodCount,
+			sortBy:         opts.SortBy,
+			separator:      ',',
+		}
+		if opts.Output == TSVOutput {
+			cp.separator = '\t'
 		}
-		tp.Print()
-	} else {
-		fmt.Printf("Called with an unsupported output type: %s", output)
-		os.Exit(1)
+		return cp.Print(w)
+	}
+
+	tp := op.tablePrinter(cc)
+	switch opts.Output {
+	case MarkdownOutput:
+		mp := &markdownPrinter{tp: tp, header: cc.reportHeader(opts)}
+		return mp.Print(w)
+	case HTMLOutput:
+		hp := &htmlPrinter{tp: tp, header: cc.reportHeader(opts)}
+		return hp.Print(w)
+	}
+	return tp.Print(w)
+}
+
+// printOptions returns the options to print the capacity with. Utilization
+// is left out if it was not collected.
+func (op *outputPrinter) printOptions(cc *ClusterCapacity) PrintOptions {
+	opts := op.opts
+	opts.ShowUtil = opts.ShowUtil && cc.options.Utilization
+	return opts
+}
+
+func (op *outputPrinter) tablePrinter(cc *ClusterCapacity) *tablePrinter {
+	opts := op.printOptions(cc)
+	return &tablePrinter{
+		cm:               &cc.cm,
+		showPods:         opts.ShowPods,
+		showUtil:         opts.ShowUtil,
+		showOverhead:     opts.ShowOverhead,
+		showPodCount:     opts.ShowPodCount,
+		showContainers:   opts.ShowContainers,
+		showNamespace:    cc.options.Namespace == "",
+		sortBy:           opts.SortBy,
+		groupBy:          opts.GroupBy,
+		groupByNodeLabel: opts.GroupByNodeLabel,
+		w:                new(tabwriter.Writer),
+		availableFormat:  opts.AvailableFormat,
 	}
 }
@@ -0,0 +1,178 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const promNamespace = "kube_capacity"
+
+// promMetricNames maps each metric exported for a resource to its name and
+// description.
+var promMetricNames = map[string][2]string{
+	"allocatable": {"allocatable", "allocatable"},
+	"request":     {"request", "requests"},
+	"limit":       {"limit", "limits"},
+	"util":        {"utilization", "utilization"},
+}
+
+// promFamily is a Prometheus gauge along with all of its samples.
+type promFamily struct {
+	name    string
+	help    string
+	samples []string
+}
+
+// promMetrics collects gauges in the Prometheus text exposition format.
+type promMetrics struct {
+	families map[string]*promFamily
+}
+
+// buildPromMetrics converts a clusterMetric into Prometheus gauges for the
+// cluster, nodes, namespaces, pods and containers.
+func buildPromMetrics(cm *clusterMetric, showUtil bool) *promMetrics {
+	pm := &promMetrics{families: map[string]*promFamily{}}
+
+	metrics := []string{"request", "limit"}
+	if showUtil {
+		metrics = append(metrics, "util")
+	}
+	withAllocatable := append([]string{"allocatable"}, metrics...)
+
+	pm.addResourceMetrics("cluster", cm.resources, nil, withAllocatable)
+	pm.add("cluster_pods", "Number of pods running in the cluster", nil, cm.podCount.current)
+	pm.add("cluster_pods_allocatable", "Number of pods that can run in the cluster", nil, cm.podCount.allocatable)
+
+	for _, nm := range cm.getSortedNodeMetrics("name") {
+		nodeLabels := []string{"node", nm.name}
+		pm.addResourceMetrics("node", nm.resources, nodeLabels, withAllocatable)
+		pm.add("node_pods", "Number of pods running on the node", nodeLabels, nm.podCount.current)
+		pm.add("node_pods_allocatable", "Number of pods that can run on the node", nodeLabels, nm.podCount.allocatable)
+
+		for _, podMetric := range nm.getSortedPodMetrics("name") {
+			podLabels := []string{"node", nm.name, "namespace", podMetric.namespace, "pod", podMetric.name}
+			pm.addResourceMetrics("pod", podMetric.resources, podLabels, metrics)
+
+			for _, ctm := range podMetric.getSortedContainerMetrics("name") {
+				containerLabels := append(append([]string{}, podLabels...), "container", ctm.name)
+				pm.addResourceMetrics("container", ctm.resources, containerLabels, metrics)
+			}
+		}
+	}
+
+	for _, gm := range cm.getSortedGroupMetrics(NamespaceGrouping, "name") {
+		namespaceLabels := []string{"namespace", gm.name}
+		pm.addResourceMetrics("namespace", gm.resources, namespaceLabels, metrics)
+		pm.add("namespace_pods", "Number of pods running in the namespace", namespaceLabels, gm.podCount.current)
+	}
+
+	return pm
+}
+
+// addResourceMetrics adds a gauge per resource and metric, for example
+// kube_capacity_node_cpu_request_millicores.
+func (pm *promMetrics) addResourceMetrics(level string, rms resourceMetrics, labels []string, metrics []string) {
+	resourceNames := []string{}
+	for name := range rms {
+		resourceNames = append(resourceNames, name)
+	}
+	sort.Strings(resourceNames)
+
+	for _, resourceName := range resourceNames {
+		rm := rms[resourceName]
+		unit := rawUnit(resourceName)
+
+		for _, metric := range metrics {
+			q := rm.allocatable
+			if metric != "allocatable" {
+				q, _ = rm.metricQuantity(metric)
+			}
+
+			name := fmt.Sprintf("%s_%s_%s", level, promName(resourceName), promMetricNames[metric][0])
+			help := fmt.Sprintf("Total %s %s of the %s", resourceName, promMetricNames[metric][1], level)
+			if unit != "" {
+				name += "_" + unit
+				help += " in " + unit
+			}
+
+			pm.add(name, help, labels, rawValue(resourceName, q))
+		}
+	}
+}
+
+// add adds a sample to a gauge. Labels are given as name and value pairs.
+func (pm *promMetrics) add(name, help string, labels []string, value int64) {
+	name = promNamespace + "_" + name
+
+	family, ok := pm.families[name]
+	if !ok {
+		family = &promFamily{name: name, help: help}
+		pm.families[name] = family
+	}
+
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], promEscape(labels[i+1])))
+	}
+
+	sample := name
+	if len(pairs) > 0 {
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	family.samples = append(family.samples, fmt.Sprintf("%s %d", sample, value))
+}
+
+// bytes renders the gauges in the Prometheus text exposition format, sorted
+// by name.
+func (pm *promMetrics) bytes() []byte {
+	names := []string{}
+	for name := range pm.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		family := pm.families[name]
+		fmt.Fprintf(&buf, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", family.name)
+		for _, sample := range family.samples {
+			fmt.Fprintln(&buf, sample)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// promName converts a resource name such as nvidia.com/gpu into a valid
+// metric name component.
+func promName(resourceName string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, resourceName)
+}
+
+// promEscape escapes backslashes, double quotes and line feeds in a label
+// value.
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
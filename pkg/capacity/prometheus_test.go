@@ -0,0 +1,74 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildPromMetrics(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	output := string(buildPromMetrics(&cm, false).bytes())
+	lines := strings.Split(output, "\n")
+
+	assert.Contains(t, lines, "# HELP kube_capacity_node_cpu_request_millicores Total cpu requests of the node in millicores")
+	assert.Contains(t, lines, "# TYPE kube_capacity_node_cpu_request_millicores gauge")
+	assert.Contains(t, lines, `kube_capacity_node_cpu_request_millicores{node="example-node-1"} 500`)
+	assert.Contains(t, lines, `kube_capacity_node_memory_allocatable_bytes{node="example-node-2"} 4194304000`)
+	assert.Contains(t, lines, `kube_capacity_node_pods{node="example-node-1"} 2`)
+	assert.Contains(t, lines, "kube_capacity_cluster_cpu_allocatable_millicores 2000")
+	assert.Contains(t, lines, "kube_capacity_cluster_pods_allocatable 220")
+	assert.Contains(t, lines, `kube_capacity_namespace_cpu_limit_millicores{namespace="kube-system"} 900`)
+	assert.Contains(t, lines, `kube_capacity_pod_cpu_request_millicores{node="example-node-2",namespace="kube-system",pod="proxy"} 400`)
+	assert.Contains(t, lines, `kube_capacity_container_cpu_limit_millicores{node="example-node-1",namespace="default",pod="web",container="web"} 400`)
+	assert.NotContains(t, output, "utilization")
+
+	assert.Contains(t, string(buildPromMetrics(&cm, true).bytes()), "kube_capacity_node_cpu_utilization_millicores")
+}
+
+func TestPromName(t *testing.T) {
+	assert.Equal(t, "nvidia_com_gpu", promName("nvidia.com/gpu"))
+	assert.Equal(t, "hugepages_2Mi", promName("hugepages-2Mi"))
+	assert.Equal(t, "bytes", rawUnit("hugepages-2Mi"))
+	assert.Equal(t, "", rawUnit("nvidia.com/gpu"))
+	assert.Equal(t, `a\"b\\c\nd`, promEscape("a\"b\\c\nd"))
+}
+
+func TestExporterRefresh(t *testing.T) {
+	node := groupTestNode("example-node-1")
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	orphan := groupTestPod("example-node-9", "default", "orphan", "100m", "100m")
+
+	e := &exporter{
+		collector: startTestCollector(t, Options{Clientset: fake.NewSimpleClientset(&node, &web, &orphan)}),
+	}
+	e.refresh(context.TODO())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `kube_capacity_node_cpu_request_millicores{node="example-node-1"} 200`)
+	assert.NotContains(t, body, "orphan")
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+}
@@ -0,0 +1,290 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/robscott/kube-capacity/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// reportHeader describes where and when a report was generated.
+type reportHeader struct {
+	Context   string
+	Generated string
+	Filters   []string
+}
+
+// newReportHeader returns the header of a report, listing the flags that
+// filter or group the data as "--flag=value".
+func newReportHeader(kubeContext, kubeConfig string, flags [][2]string) *reportHeader {
+	rh := &reportHeader{
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Filters:   []string{},
+	}
+
+	context, err := kube.CurrentContext(kubeContext, kubeConfig)
+	if err != nil || context == "" {
+		context = "unknown"
+	}
+	rh.Context = context
+
+	for _, flag := range flags {
+		if flag[1] != "" {
+			rh.Filters = append(rh.Filters, fmt.Sprintf("--%s=%s", flag[0], flag[1]))
+		}
+	}
+
+	return rh
+}
+
+// reportHeader returns the header of a report on the capacity, listing the
+// options used to collect and group it.
+func (cc *ClusterCapacity) reportHeader(opts PrintOptions) *reportHeader {
+	grouping := ""
+	if opts.GroupBy != NodeGrouping {
+		grouping = opts.GroupBy
+	}
+
+	return newReportHeader(cc.options.KubeContext, cc.options.KubeConfig, [][2]string{
+		{"namespace", cc.options.Namespace},
+		{"namespace-labels", cc.options.NamespaceLabels},
+		{"node-labels", cc.options.NodeLabels},
+		{"pod-labels", cc.options.PodLabels},
+		{"group-by", grouping},
+		{"group-by-node-label", opts.GroupByNodeLabel},
+	})
+}
+
+func (rh *reportHeader) filtersString() string {
+	if len(rh.Filters) == 0 {
+		return "none"
+	}
+	return strings.Join(rh.Filters, " ")
+}
+
+// markdownPrinter outputs the table as a GitHub flavored Markdown table.
+type markdownPrinter struct {
+	tp     *tablePrinter
+	header *reportHeader
+}
+
+func (mp *markdownPrinter) Print(w io.Writer) error {
+	fmt.Fprintln(w, "# Kube Capacity Report")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "- **Context:** %s\n", markdownCell(mp.header.Context))
+	fmt.Fprintf(w, "- **Generated:** %s\n", mp.header.Generated)
+	fmt.Fprintf(w, "- **Filters:** %s\n", markdownCell(mp.header.filtersString()))
+	fmt.Fprintln(w)
+
+	for i, line := range mp.tp.getLines() {
+		cells := make([]string, len(line))
+		for j, item := range line {
+			cells[j] = markdownCell(item)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+
+		if i == 0 {
+			separators := make([]string, len(line))
+			for j := range separators {
+				separators[j] = "---"
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(separators, " | "))
+		}
+	}
+
+	return nil
+}
+
+// markdownCell escapes characters that would otherwise break a table cell or
+// be rendered as emphasis.
+func markdownCell(s string) string {
+	return strings.NewReplacer(`|`, `\|`, `*`, `\*`, `_`, `\_`).Replace(s)
+}
+
+// htmlPrinter outputs a standalone HTML report with a sortable table and
+// per-node utilization bars.
+type htmlPrinter struct {
+	tp     *tablePrinter
+	header *reportHeader
+}
+
+type htmlReport struct {
+	Header  *reportHeader
+	Columns []string
+	Rows    [][]string
+	Nodes   []*htmlNode
+}
+
+type htmlNode struct {
+	Name      string
+	Resources []*htmlResource
+}
+
+type htmlResource struct {
+	Name string
+	Bars []*htmlBar
+}
+
+type htmlBar struct {
+	Label   string
+	Value   string
+	Percent int64
+	Width   int64
+}
+
+func (hp *htmlPrinter) Print(w io.Writer) error {
+	lines := hp.tp.getLines()
+
+	report := &htmlReport{
+		Header:  hp.header,
+		Columns: lines[0],
+		Rows:    lines[1:],
+		Nodes:   hp.buildNodes(),
+	}
+
+	return htmlReportTemplate.Execute(w, report)
+}
+
+func (hp *htmlPrinter) buildNodes() []*htmlNode {
+	nodes := []*htmlNode{}
+
+	for _, nm := range hp.tp.cm.getSortedNodeMetrics(hp.tp.sortBy) {
+		node := &htmlNode{Name: nm.name}
+
+		for _, name := range hp.tp.cm.resourceNames {
+			rm := nm.resources[name]
+			hr := &htmlResource{
+				Name: resourceHeader(name),
+				Bars: []*htmlBar{
+					newHTMLBar("requests", rm, rm.request),
+					newHTMLBar("limits", rm, rm.limit),
+				},
+			}
+			if hp.tp.showUtil {
+				hr.Bars = append(hr.Bars, newHTMLBar("util", rm, rm.utilization))
+			}
+			node.Resources = append(node.Resources, hr)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+func newHTMLBar(label string, rm *resourceMetric, q resource.Quantity) *htmlBar {
+	bar := &htmlBar{
+		Label:   label,
+		Value:   formatQuantity(rm.resourceType, q),
+		Percent: rm.percent(q),
+	}
+
+	bar.Width = bar.Percent
+	if bar.Width > 100 {
+		bar.Width = 100
+	}
+
+	return bar
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Kube Capacity Report - {{ .Header.Context }}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border: 1px solid #d0d7de; padding: 4px 10px; text-align: left; white-space: nowrap; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+.nodes { display: flex; flex-wrap: wrap; gap: 1em; }
+.node { border: 1px solid #d0d7de; border-radius: 6px; padding: 0.5em 1em; min-width: 18em; }
+.bar { display: flex; align-items: center; gap: 0.5em; font-size: 0.85em; }
+.bar .label { width: 9em; }
+.bar .track { flex: 1; background: #eaeef2; height: 0.8em; border-radius: 4px; overflow: hidden; }
+.bar .fill { height: 100%; background: #2da44e; }
+.bar .fill.warn { background: #d4a72c; }
+.bar .fill.over { background: #cf222e; }
+.bar .value { width: 4em; text-align: right; }
+</style>
+</head>
+<body>
+<h1>Kube Capacity Report</h1>
+<p>
+<strong>Context:</strong> {{ .Header.Context }}<br>
+<strong>Generated:</strong> {{ .Header.Generated }}<br>
+<strong>Filters:</strong> {{ if .Header.Filters }}{{ range .Header.Filters }}<code>{{ . }}</code> {{ end }}{{ else }}none{{ end }}
+</p>
+<h2>Nodes</h2>
+<div class="nodes">
+{{- range .Nodes }}
+<div class="node">
+<h3>{{ .Name }}</h3>
+{{- range .Resources }}
+{{- $resource := .Name }}
+{{- range .Bars }}
+<div class="bar" title="{{ $resource }} {{ .Label }}: {{ .Value }}">
+<span class="label">{{ $resource }} {{ .Label }}</span>
+<span class="track"><span class="fill{{ if gt .Percent 100 }} over{{ else if gt .Percent 80 }} warn{{ end }}" style="width: {{ .Width }}%; display: block;"></span></span>
+<span class="value">{{ .Percent }}%</span>
+</div>
+{{- end }}
+{{- end }}
+</div>
+{{- end }}
+</div>
+<h2>Details</h2>
+<table class="sortable">
+<thead>
+<tr>{{ range .Columns }}<th>{{ . }}</th>{{ end }}</tr>
+</thead>
+<tbody>
+{{- range .Rows }}
+<tr>{{ range . }}<td>{{ . }}</td>{{ end }}</tr>
+{{- end }}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("table.sortable th").forEach(function (th, column) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table");
+    var tbody = table.querySelector("tbody");
+    var asc = !th.classList.contains("asc");
+    table.querySelectorAll("th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+    th.classList.add(asc ? "asc" : "desc");
+    var value = function (row) {
+      var text = row.children[column].textContent.trim();
+      var number = parseFloat(text);
+      return isNaN(number) ? text : number;
+    };
+    Array.from(tbody.rows).sort(function (a, b) {
+      var va = value(a), vb = value(b);
+      var result = (typeof va === typeof vb) ? (va < vb ? -1 : va > vb ? 1 : 0) : (typeof va === "number" ? -1 : 1);
+      return asc ? result : -result;
+    }).forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
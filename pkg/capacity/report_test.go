@@ -0,0 +1,89 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownPrinter(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	mp := &markdownPrinter{
+		tp: &tablePrinter{
+			cm:            &cm,
+			showPods:      true,
+			showNamespace: true,
+			sortBy:        "name",
+		},
+		header: &reportHeader{
+			Context:   "prod_cluster",
+			Generated: "2024-01-02T03:04:05Z",
+			Filters:   []string{"--namespace=kube-system"},
+		},
+	}
+
+	var buf bytes.Buffer
+	mp.Print(&buf)
+
+	assert.Equal(t, []string{
+		"# Kube Capacity Report",
+		"",
+		`- **Context:** prod\_cluster`,
+		"- **Generated:** 2024-01-02T03:04:05Z",
+		`- **Filters:** --namespace=kube-system`,
+		"",
+		"| NODE | NAMESPACE | POD | CPU REQUESTS | CPU LIMITS | MEMORY REQUESTS | MEMORY LIMITS |",
+		"| --- | --- | --- | --- | --- | --- | --- |",
+		`| \* | \* | \* | 900m (45%) | 1300m (65%) | 0Mi (0%) | 0Mi (0%) |`,
+		`| example-node-1 | \* | \* | 500m (50%) | 800m (80%) | 0Mi (0%) | 0Mi (0%) |`,
+		"| example-node-1 | kube-system | dns | 300m (30%) | 400m (40%) | 0Mi (0%) | 0Mi (0%) |",
+		"| example-node-1 | default | web | 200m (20%) | 400m (40%) | 0Mi (0%) | 0Mi (0%) |",
+		`| example-node-2 | \* | \* | 400m (40%) | 500m (50%) | 0Mi (0%) | 0Mi (0%) |`,
+		"| example-node-2 | kube-system | proxy | 400m (40%) | 500m (50%) | 0Mi (0%) | 0Mi (0%) |",
+		"",
+	}, strings.Split(buf.String(), "\n"))
+}
+
+func TestHTMLPrinter(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+
+	hp := &htmlPrinter{
+		tp: &tablePrinter{
+			cm:     &cm,
+			sortBy: "name",
+		},
+		header: &reportHeader{
+			Context:   "<prod>",
+			Generated: "2024-01-02T03:04:05Z",
+		},
+	}
+
+	var buf bytes.Buffer
+	hp.Print(&buf)
+	output := buf.String()
+
+	assert.Contains(t, output, "<strong>Context:</strong> &lt;prod&gt;")
+	assert.Contains(t, output, "<strong>Filters:</strong> none")
+	assert.Contains(t, output, "<th>CPU REQUESTS</th>")
+	assert.Contains(t, output, "<td>example-node-1</td><td>500m (50%)</td>")
+	assert.Contains(t, output, `<div class="bar" title="CPU limits: 800m">`)
+	assert.Contains(t, output, `<span class="value">80%</span>`)
+	assert.NotContains(t, output, "util")
+}
@@ -17,9 +17,12 @@ package capacity
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	resourcehelper "k8s.io/kubectl/pkg/util/resource"
 	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
@@ -38,127 +41,318 @@ var SupportedSortAttributes = [...]string{
 	"mem.util.percentage",
 	"mem.request.percentage",
 	"mem.limit.percentage",
+	"ephemeral-storage.util",
+	"ephemeral-storage.request",
+	"ephemeral-storage.limit",
+	"ephemeral-storage.util.percentage",
+	"ephemeral-storage.request.percentage",
+	"ephemeral-storage.limit.percentage",
 	"name",
 }
 
+// DefaultResources lists the resources reported when none are specified.
+var DefaultResources = []string{"cpu", "memory"}
+
 // Mebibyte represents the number of bytes in a mebibyte.
 const Mebibyte = 1024 * 1024
 
+// pendingNodeName is the name of the pseudo node pending pods are added to.
+const pendingNodeName = "<pending>"
+
 type resourceMetric struct {
 	resourceType string
 	allocatable  resource.Quantity
 	utilization  resource.Quantity
 	request      resource.Quantity
 	limit        resource.Quantity
+	// overhead is the part of request that is pod overhead from a
+	// RuntimeClass rather than requested by containers.
+	overhead resource.Quantity
 }
 
+// resourceMetrics maps a resource name such as "cpu" or "nvidia.com/gpu" to
+// its metric.
+type resourceMetrics map[string]*resourceMetric
+
 type clusterMetric struct {
-	cpu         *resourceMetric
-	memory      *resourceMetric
-	nodeMetrics map[string]*nodeMetric
-	podCount    *podCount
+	resourceNames []string
+	resources     resourceMetrics
+	nodeMetrics   map[string]*nodeMetric
+	podCount      *podCount
+	// pending holds the pods that are not scheduled on a node yet, when
+	// they are collected. It is not included in the cluster totals.
+	pending *nodeMetric
+	// podStorage holds the ephemeral storage usage of each pod as a whole
+	// from the kubelet summary API, keyed like pod metrics.
+	podStorage map[string]resource.Quantity
 }
 
 type nodeMetric struct {
-	name       string
-	cpu        *resourceMetric
-	memory     *resourceMetric
-	podMetrics map[string]*podMetric
-	podCount   *podCount
+	name          string
+	labels        map[string]string
+	taints        []corev1.Taint
+	unschedulable bool
+	resources     resourceMetrics
+	podMetrics    map[string]*podMetric
+	podCount      *podCount
+	// antiAffinityPods counts the pods with required anti-affinity, so that
+	// placing pods only looks through the nodes that have any.
+	antiAffinityPods int
 }
 
 type podMetric struct {
 	name             string
 	namespace        string
-	cpu              *resourceMetric
-	memory           *resourceMetric
+	labels           map[string]string
+	controller       *metav1.OwnerReference
+	workload         workloadRef
+	created          time.Time
+	runtimeClass     string
+	resources        resourceMetrics
 	containerMetrics map[string]*containerMetric
+	// schedulingReason and schedulingMessage explain why the scheduler has
+	// not placed the pod, if it has tried and failed.
+	schedulingReason  string
+	schedulingMessage string
+	// antiAffinity holds the required anti-affinity terms of the pod, which
+	// keep pods they match out of its topology domains.
+	antiAffinity []*podAffinityTerm
 }
 
+// containerMetric is the metric of a container. For init and sidecar
+// containers, initIndex is their position among the init containers of the
+// pod, which is the order they start in.
 type containerMetric struct {
-	name   string
-	cpu    *resourceMetric
-	memory *resourceMetric
+	name          string
+	containerType string
+	initIndex     int
+	resources     resourceMetrics
 }
 
+// The types of container in a pod. Init containers run one at a time before
+// the app containers start. Sidecars are init containers that keep running
+// alongside the app containers once started, and ephemeral containers are
+// added to running pods for debugging.
+const (
+	appContainerType       = "app"
+	initContainerType      = "init"
+	sidecarContainerType   = "sidecar"
+	ephemeralContainerType = "ephemeral"
+)
+
 type podCount struct {
 	current     int64
 	allocatable int64
 }
 
 func buildClusterMetric(podList *corev1.PodList, pmList *v1beta1.PodMetricsList,
-	nodeList *corev1.NodeList, nmList *v1beta1.NodeMetricsList) clusterMetric {
+	nodeList *corev1.NodeList, nmList *v1beta1.NodeMetricsList, resourceNames []string) clusterMetric {
+	cm := newClusterMetric(nodeList, nmList, resourceNames)
+
+	podMetrics := indexPodMetrics(pmList)
+	for i := range podList.Items {
+		cm.addPod(&podList.Items[i], podMetrics)
+	}
+
+	cm.addNodeMetrics(nmList == nil)
+
+	return cm
+}
+
+// newClusterMetric returns a cluster metric with the nodes but no pods yet.
+// Pods are added with addPod, then addNodeMetrics totals up the nodes.
+func newClusterMetric(nodeList *corev1.NodeList, nmList *v1beta1.NodeMetricsList, resourceNames []string) clusterMetric {
 	cm := clusterMetric{
-		cpu:         &resourceMetric{resourceType: "cpu"},
-		memory:      &resourceMetric{resourceType: "memory"},
-		nodeMetrics: map[string]*nodeMetric{},
-		podCount:    &podCount{},
-	}
-
-	var totalPodAllocatable int64
-	var totalPodCurrent int64
-	for _, node := range nodeList.Items {
-		var tmpPodCount int64
-		for _, pod := range podList.Items {
-			if pod.Spec.NodeName == node.Name && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
-				tmpPodCount++
-			}
-		}
-		totalPodCurrent += tmpPodCount
-		totalPodAllocatable += node.Status.Allocatable.Pods().Value()
-		cm.nodeMetrics[node.Name] = &nodeMetric{
-			name: node.Name,
-			cpu: &resourceMetric{
-				resourceType: "cpu",
-				allocatable:  node.Status.Allocatable["cpu"],
-			},
-			memory: &resourceMetric{
-				resourceType: "memory",
-				allocatable:  node.Status.Allocatable["memory"],
-			},
-			podMetrics: map[string]*podMetric{},
-			podCount: &podCount{
-				current:     tmpPodCount,
-				allocatable: node.Status.Allocatable.Pods().Value(),
-			},
-		}
+		resourceNames: resourceNames,
+		resources:     newResourceMetrics(resourceNames),
+		nodeMetrics:   map[string]*nodeMetric{},
+		podCount:      &podCount{},
+	}
+
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		cm.podCount.allocatable += node.Status.Allocatable.Pods().Value()
+		cm.nodeMetrics[node.Name] = newNodeMetric(node, resourceNames)
+	}
+
+	cm.addNodeUtilization(nmList)
+
+	return cm
+}
+
+// newNodeMetric returns the metric of a node without any pods.
+func newNodeMetric(node *corev1.Node, resourceNames []string) *nodeMetric {
+	resources := newResourceMetrics(resourceNames)
+	for name, rm := range resources {
+		rm.allocatable = node.Status.Allocatable[corev1.ResourceName(name)]
 	}
 
-	cm.podCount.current = totalPodCurrent
-	cm.podCount.allocatable = totalPodAllocatable
+	return &nodeMetric{
+		name:          node.Name,
+		labels:        node.Labels,
+		taints:        node.Spec.Taints,
+		unschedulable: node.Spec.Unschedulable,
+		resources:     resources,
+		podMetrics:    map[string]*podMetric{},
+		podCount: &podCount{
+			allocatable: node.Status.Allocatable.Pods().Value(),
+		},
+	}
+}
 
-	if nmList != nil {
-		for _, nm := range nmList.Items {
-			cm.nodeMetrics[nm.Name].cpu.utilization = nm.Usage["cpu"]
-			cm.nodeMetrics[nm.Name].memory.utilization = nm.Usage["memory"]
+// addPending makes pods that are not scheduled on a node yet be added to a
+// pending pseudo node instead of being skipped.
+func (cm *clusterMetric) addPending() {
+	cm.pending = &nodeMetric{
+		name:       pendingNodeName,
+		resources:  newResourceMetrics(cm.resourceNames),
+		podMetrics: map[string]*podMetric{},
+		podCount:   &podCount{},
+	}
+}
+
+// addNodeUtilization sets the utilization of each node from node metrics.
+func (cm *clusterMetric) addNodeUtilization(nmList *v1beta1.NodeMetricsList) {
+	if nmList == nil {
+		return
+	}
+
+	for _, nm := range nmList.Items {
+		if node, ok := cm.nodeMetrics[nm.Name]; ok {
+			for name, rm := range node.resources {
+				rm.utilization = nm.Usage[corev1.ResourceName(name)]
+			}
 		}
 	}
+}
 
+// indexPodMetrics keys pod metrics by "namespace-name" for addPod.
+func indexPodMetrics(pmList *v1beta1.PodMetricsList) map[string]v1beta1.PodMetrics {
 	podMetrics := map[string]v1beta1.PodMetrics{}
 	if pmList != nil {
 		for _, pm := range pmList.Items {
 			podMetrics[fmt.Sprintf("%s-%s", pm.GetNamespace(), pm.GetName())] = pm
 		}
 	}
+	return podMetrics
+}
+
+// addPod adds a running pod to the node it is scheduled on and returns true.
+// Pods on nodes that are not included and completed pods are skipped, as are
+// unscheduled pods unless pending pods are collected.
+func (cm *clusterMetric) addPod(pod *corev1.Pod, podMetrics map[string]v1beta1.PodMetrics) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+
+	nm := cm.podNode(pod.Spec.NodeName)
+	if nm == nil {
+		return false
+	}
+
+	key := fmt.Sprintf("%s-%s", pod.GetNamespace(), pod.GetName())
+	nm.podCount.current++
+	if nm != cm.pending {
+		cm.podCount.current++
+	}
+	cm.addPodMetric(nm, key, pod, podMetrics[key])
+	return true
+}
+
+// removePod removes a pod added with addPod from the node it was added to.
+func (cm *clusterMetric) removePod(nodeName, key string) {
+	nm := cm.podNode(nodeName)
+	if nm == nil {
+		return
+	}
+
+	pm, ok := nm.podMetrics[key]
+	if !ok {
+		return
+	}
+
+	delete(nm.podMetrics, key)
+	if len(pm.antiAffinity) > 0 {
+		nm.antiAffinityPods--
+	}
+	nm.podCount.current--
+	if nm != cm.pending {
+		cm.podCount.current--
+	}
+	for name, rm := range nm.resources {
+		rm.request.Sub(pm.resources[name].request)
+		rm.limit.Sub(pm.resources[name].limit)
+		rm.overhead.Sub(pm.resources[name].overhead)
+	}
+}
+
+// podNode returns the node pods with the given node name are added to, which
+// is the pending pseudo node for unscheduled pods, or nil if there is none.
+func (cm *clusterMetric) podNode(nodeName string) *nodeMetric {
+	if nodeName == "" {
+		return cm.pending
+	}
+	return cm.nodeMetrics[nodeName]
+}
+
+// addUtilization sets the utilization of the pods and containers that have
+// already been added, and of the nodes if node metrics are given.
+func (cm *clusterMetric) addUtilization(pmList *v1beta1.PodMetricsList, nmList *v1beta1.NodeMetricsList) {
+	cm.addNodeUtilization(nmList)
+
+	podMetrics := indexPodMetrics(pmList)
+	for _, nm := range cm.nodeMetrics {
+		for key, pm := range nm.podMetrics {
+			pm.addUtilization(podMetrics[key])
+			cm.addPodStorage(key, pm)
+		}
+	}
+}
 
-	for _, pod := range podList.Items {
-		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
-			cm.addPodMetric(&pod, podMetrics[fmt.Sprintf("%s-%s", pod.GetNamespace(), pod.GetName())])
+// addNodeMetrics adds the nodes, with the requests and limits of their pods,
+// to the cluster totals. When sumPodUtilization is set, as it is when
+// namespace filtering is configured, node utilization is summed from the
+// pods instead of relying on node metrics.
+func (cm *clusterMetric) addNodeMetrics(sumPodUtilization bool) {
+	for _, nm := range cm.nodeMetrics {
+		cm.addNodeMetric(nm)
+		if sumPodUtilization {
+			nm.addPodUtilization()
 		}
 	}
 
-	for _, node := range nodeList.Items {
-		if nm, ok := cm.nodeMetrics[node.Name]; ok {
-			cm.addNodeMetric(nm)
-			// When namespace filtering is configured, we want to sum pod
-			// utilization instead of relying on node util.
-			if nmList == nil {
-				nm.addPodUtilization()
+	// Pending pods could go anywhere in the cluster, so their demand is
+	// relative to what the whole cluster can allocate.
+	if cm.pending != nil {
+		cm.pending.setAllocatable(cm.resources, cm.podCount.allocatable)
+	}
+}
+
+// setAllocatable sets the allocatable amount of the node, its pods and their
+// containers.
+func (nm *nodeMetric) setAllocatable(rms resourceMetrics, pods int64) {
+	nm.podCount.allocatable = pods
+	for name, rm := range nm.resources {
+		rm.allocatable = rms[name].allocatable
+	}
+	for _, pm := range nm.podMetrics {
+		for name, rm := range pm.resources {
+			rm.allocatable = rms[name].allocatable
+		}
+		for _, ctm := range pm.containerMetrics {
+			for name, rm := range ctm.resources {
+				rm.allocatable = rms[name].allocatable
 			}
 		}
 	}
+}
 
-	return cm
+func newResourceMetrics(resourceNames []string) resourceMetrics {
+	rms := resourceMetrics{}
+	for _, name := range resourceNames {
+		rms[name] = &resourceMetric{resourceType: name}
+	}
+	return rms
 }
 
 func (rm *resourceMetric) addMetric(m *resourceMetric) {
@@ -166,80 +360,234 @@ func (rm *resourceMetric) addMetric(m *resourceMetric) {
 	rm.utilization.Add(m.utilization)
 	rm.request.Add(m.request)
 	rm.limit.Add(m.limit)
+	rm.overhead.Add(m.overhead)
 }
 
-func (cm *clusterMetric) addPodMetric(pod *corev1.Pod, podMetrics v1beta1.PodMetrics) {
+func (rms resourceMetrics) addMetrics(m resourceMetrics) {
+	for name, rm := range rms {
+		if other, ok := m[name]; ok {
+			rm.addMetric(other)
+		}
+	}
+}
+
+func (rms resourceMetrics) copy() resourceMetrics {
+	out := resourceMetrics{}
+	for name, rm := range rms {
+		out[name] = &resourceMetric{
+			resourceType: rm.resourceType,
+			allocatable:  rm.allocatable.DeepCopy(),
+			utilization:  rm.utilization.DeepCopy(),
+			request:      rm.request.DeepCopy(),
+			limit:        rm.limit.DeepCopy(),
+			overhead:     rm.overhead.DeepCopy(),
+		}
+	}
+	return out
+}
+
+// copy returns a copy of the node and its pods that can be modified without
+// affecting the original.
+func (nm *nodeMetric) copy() *nodeMetric {
+	out := *nm
+	out.resources = nm.resources.copy()
+	out.podCount = &podCount{current: nm.podCount.current, allocatable: nm.podCount.allocatable}
+	out.podMetrics = map[string]*podMetric{}
+	for key, pm := range nm.podMetrics {
+		out.podMetrics[key] = pm.copy()
+	}
+	return &out
+}
+
+func (pm *podMetric) copy() *podMetric {
+	out := *pm
+	out.resources = pm.resources.copy()
+	out.containerMetrics = map[string]*containerMetric{}
+	for name, ctm := range pm.containerMetrics {
+		out.containerMetrics[name] = &containerMetric{name: ctm.name, containerType: ctm.containerType, initIndex: ctm.initIndex,
+			resources: ctm.resources.copy()}
+	}
+	return &out
+}
+
+// addPodMetric adds the metric of a pod to the node it is scheduled on.
+func (cm *clusterMetric) addPodMetric(nm *nodeMetric, key string, pod *corev1.Pod, podMetrics v1beta1.PodMetrics) {
 	req, limit := resourcehelper.PodRequestsAndLimits(pod)
-	key := fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
-	nm := cm.nodeMetrics[pod.Spec.NodeName]
 
 	pm := &podMetric{
-		name:      pod.Name,
-		namespace: pod.Namespace,
-		cpu: &resourceMetric{
-			resourceType: "cpu",
-			request:      req["cpu"],
-			limit:        limit["cpu"],
-		},
-		memory: &resourceMetric{
-			resourceType: "memory",
-			request:      req["memory"],
-			limit:        limit["memory"],
-		},
+		name:             pod.Name,
+		namespace:        pod.Namespace,
+		labels:           pod.Labels,
+		controller:       metav1.GetControllerOf(pod),
+		created:          pod.CreationTimestamp.Time,
+		resources:        newResourceMetrics(cm.resourceNames),
 		containerMetrics: map[string]*containerMetric{},
 	}
 
-	for _, container := range pod.Spec.Containers {
-		pm.containerMetrics[container.Name] = &containerMetric{
-			name: container.Name,
-			cpu: &resourceMetric{
-				resourceType: "cpu",
-				request:      container.Resources.Requests["cpu"],
-				limit:        container.Resources.Limits["cpu"],
-				allocatable:  nm.cpu.allocatable,
-			},
-			memory: &resourceMetric{
-				resourceType: "memory",
-				request:      container.Resources.Requests["memory"],
-				limit:        container.Resources.Limits["memory"],
-				allocatable:  nm.memory.allocatable,
-			},
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			pm.schedulingReason = condition.Reason
+			pm.schedulingMessage = condition.Message
 		}
 	}
 
-	if nm != nil {
-		nm.podMetrics[key] = pm
-		nm.podMetrics[key].cpu.allocatable = nm.cpu.allocatable
-		nm.podMetrics[key].memory.allocatable = nm.memory.allocatable
+	if pod.Spec.RuntimeClassName != nil {
+		pm.runtimeClass = *pod.Spec.RuntimeClassName
+	}
 
-		nm.cpu.request.Add(req["cpu"])
-		nm.cpu.limit.Add(limit["cpu"])
-		nm.memory.request.Add(req["memory"])
-		nm.memory.limit.Add(limit["memory"])
+	if pod.Spec.Affinity != nil && pod.Spec.Affinity.PodAntiAffinity != nil {
+		pm.antiAffinity = newPodAffinityTerms(pod.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			pod.Namespace)
 	}
 
+	for name, rm := range pm.resources {
+		rm.request = req[corev1.ResourceName(name)]
+		rm.limit = limit[corev1.ResourceName(name)]
+		rm.overhead = pod.Spec.Overhead[corev1.ResourceName(name)]
+		rm.allocatable = nm.resources[name].allocatable
+	}
+
+	for i := range pod.Spec.Containers {
+		pm.addContainerMetric(nm, &pod.Spec.Containers[i], appContainerType, cm.resourceNames)
+	}
+	for i := range pod.Spec.InitContainers {
+		container := &pod.Spec.InitContainers[i]
+		containerType := initContainerType
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			containerType = sidecarContainerType
+		}
+		pm.addContainerMetric(nm, container, containerType, cm.resourceNames).initIndex = i
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		container := corev1.Container(pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		pm.addContainerMetric(nm, &container, ephemeralContainerType, cm.resourceNames)
+	}
+
+	nm.podMetrics[key] = pm
+	if len(pm.antiAffinity) > 0 {
+		nm.antiAffinityPods++
+	}
+	for name, rm := range nm.resources {
+		rm.request.Add(req[corev1.ResourceName(name)])
+		rm.limit.Add(limit[corev1.ResourceName(name)])
+		rm.overhead.Add(pod.Spec.Overhead[corev1.ResourceName(name)])
+	}
+
+	pm.addUtilization(podMetrics)
+	cm.addPodStorage(key, pm)
+}
+
+// addPodStorage replaces the ephemeral storage utilization of a pod, summed
+// from its containers, with that of the pod as a whole, which also includes
+// volumes such as emptyDir.
+func (cm *clusterMetric) addPodStorage(key string, pm *podMetric) {
+	usage, ok := cm.podStorage[key]
+	rm := pm.resources[string(corev1.ResourceEphemeralStorage)]
+	if !ok || rm == nil {
+		return
+	}
+	rm.utilization = usage.DeepCopy()
+}
+
+func (pm *podMetric) addContainerMetric(nm *nodeMetric, container *corev1.Container, containerType string,
+	resourceNames []string) *containerMetric {
+	ctm := &containerMetric{
+		name:          container.Name,
+		containerType: containerType,
+		resources:     newResourceMetrics(resourceNames),
+	}
+	for name, rm := range ctm.resources {
+		rm.request = container.Resources.Requests[corev1.ResourceName(name)]
+		rm.limit = container.Resources.Limits[corev1.ResourceName(name)]
+		rm.allocatable = nm.resources[name].allocatable
+	}
+	pm.containerMetrics[container.Name] = ctm
+	return ctm
+}
+
+// requestBreakdown shows how the request of a pod for a resource follows from
+// its containers.
+type requestBreakdown struct {
+	// containers is the sum of the requests of the app containers.
+	containers resource.Quantity
+	// sidecars is the sum of the requests of the sidecar containers.
+	sidecars resource.Quantity
+	// initContainers is the most needed while the init containers start,
+	// which for each init container is its request plus that of the
+	// sidecars started before it.
+	initContainers resource.Quantity
+	// overhead is the pod overhead of its RuntimeClass.
+	overhead resource.Quantity
+	// effective is what the scheduler reserves for the pod, the larger of
+	// containers plus sidecars and initContainers, plus overhead.
+	effective resource.Quantity
+}
+
+// requestBreakdown returns how the request of the pod for a resource adds up.
+// Ephemeral containers cannot have requests, so they are not counted.
+func (pm *podMetric) requestBreakdown(resourceName string) requestBreakdown {
+	rm := pm.resources[resourceName]
+	rb := requestBreakdown{
+		overhead:  rm.overhead.DeepCopy(),
+		effective: rm.request.DeepCopy(),
+	}
+
+	initContainers := []*containerMetric{}
+	for _, ctm := range pm.containerMetrics {
+		switch ctm.containerType {
+		case appContainerType:
+			rb.containers.Add(ctm.resources[resourceName].request)
+		case initContainerType, sidecarContainerType:
+			initContainers = append(initContainers, ctm)
+		}
+	}
+	sort.Slice(initContainers, func(i, j int) bool {
+		return initContainers[i].initIndex < initContainers[j].initIndex
+	})
+
+	for _, ctm := range initContainers {
+		request := ctm.resources[resourceName].request.DeepCopy()
+		if ctm.containerType == sidecarContainerType {
+			rb.sidecars.Add(request)
+			request = rb.sidecars.DeepCopy()
+		} else {
+			request.Add(rb.sidecars)
+		}
+
+		if request.Cmp(rb.initContainers) > 0 {
+			rb.initContainers = request
+		}
+	}
+
+	return rb
+}
+
+func (pm *podMetric) addUtilization(podMetrics v1beta1.PodMetrics) {
 	for _, container := range podMetrics.Containers {
-		cm := pm.containerMetrics[container.Name]
-		if cm != nil {
-			pm.containerMetrics[container.Name].cpu.utilization = container.Usage["cpu"]
-			pm.cpu.utilization.Add(container.Usage["cpu"])
-			pm.containerMetrics[container.Name].memory.utilization = container.Usage["memory"]
-			pm.memory.utilization.Add(container.Usage["memory"])
+		ctm := pm.containerMetrics[container.Name]
+		if ctm != nil {
+			for name, rm := range ctm.resources {
+				rm.utilization = container.Usage[corev1.ResourceName(name)]
+				pm.resources[name].utilization.Add(container.Usage[corev1.ResourceName(name)])
+			}
 		}
 	}
 }
 
 func (cm *clusterMetric) addNodeMetric(nm *nodeMetric) {
-	cm.cpu.addMetric(nm.cpu)
-	cm.memory.addMetric(nm.memory)
+	cm.resources.addMetrics(nm.resources)
 }
 
 func (cm *clusterMetric) getSortedNodeMetrics(sortBy string) []*nodeMetric {
-	sortedNodeMetrics := make([]*nodeMetric, len(cm.nodeMetrics))
+	return sortNodeMetrics(cm.nodeMetrics, sortBy)
+}
+
+func sortNodeMetrics(nodeMetrics map[string]*nodeMetric, sortBy string) []*nodeMetric {
+	sortedNodeMetrics := make([]*nodeMetric, len(nodeMetrics))
 
 	i := 0
-	for name := range cm.nodeMetrics {
-		sortedNodeMetrics[i] = cm.nodeMetrics[name]
+	for name := range nodeMetrics {
+		sortedNodeMetrics[i] = nodeMetrics[name]
 		i++
 	}
 
@@ -247,45 +595,25 @@ func (cm *clusterMetric) getSortedNodeMetrics(sortBy string) []*nodeMetric {
 		m1 := sortedNodeMetrics[i]
 		m2 := sortedNodeMetrics[j]
 
-		switch sortBy {
-		case "cpu.util":
-			return m2.cpu.utilization.MilliValue() < m1.cpu.utilization.MilliValue()
-		case "cpu.limit":
-			return m2.cpu.limit.MilliValue() < m1.cpu.limit.MilliValue()
-		case "cpu.request":
-			return m2.cpu.request.MilliValue() < m1.cpu.request.MilliValue()
-		case "mem.util":
-			return m2.memory.utilization.Value() < m1.memory.utilization.Value()
-		case "mem.limit":
-			return m2.memory.limit.Value() < m1.memory.limit.Value()
-		case "mem.request":
-			return m2.memory.request.Value() < m1.memory.request.Value()
-		case "cpu.util.percentage":
-			return m2.cpu.percent(m2.cpu.utilization) < m1.cpu.percent(m1.cpu.utilization)
-		case "cpu.limit.percentage":
-			return m2.cpu.percent(m2.cpu.limit) < m1.cpu.percent(m1.cpu.limit)
-		case "cpu.request.percentage":
-			return m2.cpu.percent(m2.cpu.request) < m1.cpu.percent(m1.cpu.request)
-		case "mem.util.percentage":
-			return m2.memory.percent(m2.memory.utilization) < m1.memory.percent(m1.memory.utilization)
-		case "mem.limit.percentage":
-			return m2.memory.percent(m2.memory.limit) < m1.memory.percent(m1.memory.limit)
-		case "mem.request.percentage":
-			return m2.memory.percent(m2.memory.request) < m1.memory.percent(m1.memory.request)
-		default:
-			return m1.name < m2.name
+		if c := compareResourceMetrics(m1.resources, m2.resources, sortBy); c != 0 {
+			return c > 0
 		}
+		return m1.name < m2.name
 	})
 
 	return sortedNodeMetrics
 }
 
 func (nm *nodeMetric) getSortedPodMetrics(sortBy string) []*podMetric {
-	sortedPodMetrics := make([]*podMetric, len(nm.podMetrics))
+	return sortPodMetrics(nm.podMetrics, sortBy)
+}
+
+func sortPodMetrics(podMetrics map[string]*podMetric, sortBy string) []*podMetric {
+	sortedPodMetrics := make([]*podMetric, len(podMetrics))
 
 	i := 0
-	for name := range nm.podMetrics {
-		sortedPodMetrics[i] = nm.podMetrics[name]
+	for name := range podMetrics {
+		sortedPodMetrics[i] = podMetrics[name]
 		i++
 	}
 
@@ -293,34 +621,10 @@ func (nm *nodeMetric) getSortedPodMetrics(sortBy string) []*podMetric {
 		m1 := sortedPodMetrics[i]
 		m2 := sortedPodMetrics[j]
 
-		switch sortBy {
-		case "cpu.util":
-			return m2.cpu.utilization.MilliValue() < m1.cpu.utilization.MilliValue()
-		case "cpu.limit":
-			return m2.cpu.limit.MilliValue() < m1.cpu.limit.MilliValue()
-		case "cpu.request":
-			return m2.cpu.request.MilliValue() < m1.cpu.request.MilliValue()
-		case "mem.util":
-			return m2.memory.utilization.Value() < m1.memory.utilization.Value()
-		case "mem.limit":
-			return m2.memory.limit.Value() < m1.memory.limit.Value()
-		case "mem.request":
-			return m2.memory.request.Value() < m1.memory.request.Value()
-		case "cpu.util.percentage":
-			return m2.cpu.percent(m2.cpu.utilization) < m1.cpu.percent(m1.cpu.utilization)
-		case "cpu.limit.percentage":
-			return m2.cpu.percent(m2.cpu.limit) < m1.cpu.percent(m1.cpu.limit)
-		case "cpu.request.percentage":
-			return m2.cpu.percent(m2.cpu.request) < m1.cpu.percent(m1.cpu.request)
-		case "mem.util.percentage":
-			return m2.memory.percent(m2.memory.utilization) < m1.memory.percent(m1.memory.utilization)
-		case "mem.limit.percentage":
-			return m2.memory.percent(m2.memory.limit) < m1.memory.percent(m1.memory.limit)
-		case "mem.request.percentage":
-			return m2.memory.percent(m2.memory.request) < m1.memory.percent(m1.memory.request)
-		default:
-			return m1.name < m2.name
+		if c := compareResourceMetrics(m1.resources, m2.resources, sortBy); c != 0 {
+			return c > 0
 		}
+		return m1.name < m2.name
 	})
 
 	return sortedPodMetrics
@@ -328,8 +632,9 @@ func (nm *nodeMetric) getSortedPodMetrics(sortBy string) []*podMetric {
 
 func (nm *nodeMetric) addPodUtilization() {
 	for _, pm := range nm.podMetrics {
-		nm.cpu.utilization.Add(pm.cpu.utilization)
-		nm.memory.utilization.Add(pm.memory.utilization)
+		for name, rm := range nm.resources {
+			rm.utilization.Add(pm.resources[name].utilization)
+		}
 	}
 }
 
@@ -346,27 +651,83 @@ func (pm *podMetric) getSortedContainerMetrics(sortBy string) []*containerMetric
 		m1 := sortedContainerMetrics[i]
 		m2 := sortedContainerMetrics[j]
 
-		switch sortBy {
-		case "cpu.util":
-			return m2.cpu.utilization.MilliValue() < m1.cpu.utilization.MilliValue()
-		case "cpu.limit":
-			return m2.cpu.limit.MilliValue() < m1.cpu.limit.MilliValue()
-		case "cpu.request":
-			return m2.cpu.request.MilliValue() < m1.cpu.request.MilliValue()
-		case "mem.util":
-			return m2.memory.utilization.Value() < m1.memory.utilization.Value()
-		case "mem.limit":
-			return m2.memory.limit.Value() < m1.memory.limit.Value()
-		case "mem.request":
-			return m2.memory.request.Value() < m1.memory.request.Value()
-		default:
-			return m1.name < m2.name
+		if c := compareResourceMetrics(m1.resources, m2.resources, sortBy); c != 0 {
+			return c > 0
 		}
+		return m1.name < m2.name
 	})
 
 	return sortedContainerMetrics
 }
 
+// parseSortAttribute splits a sort attribute such as "mem.request.percentage"
+// or "nvidia.com/gpu.limit" into the resource name, the metric and whether the
+// percentage of allocatable should be compared.
+func parseSortAttribute(sortBy string) (resourceName, metric string, percentage bool) {
+	if strings.HasSuffix(sortBy, ".percentage") {
+		percentage = true
+		sortBy = strings.TrimSuffix(sortBy, ".percentage")
+	}
+
+	i := strings.LastIndex(sortBy, ".")
+	if i < 0 {
+		return "", "", false
+	}
+
+	resourceName, metric = sortBy[:i], sortBy[i+1:]
+	if resourceName == "mem" {
+		resourceName = "memory"
+	}
+
+	return resourceName, metric, percentage
+}
+
+// compareResourceMetrics compares two sets of resource metrics by the given
+// sort attribute, returning 0 when they are equal or the attribute does not
+// refer to a tracked resource.
+func compareResourceMetrics(rms1, rms2 resourceMetrics, sortBy string) int {
+	resourceName, metric, percentage := parseSortAttribute(sortBy)
+
+	rm1, ok1 := rms1[resourceName]
+	rm2, ok2 := rms2[resourceName]
+	if !ok1 || !ok2 {
+		return 0
+	}
+
+	q1, ok1 := rm1.metricQuantity(metric)
+	q2, ok2 := rm2.metricQuantity(metric)
+	if !ok1 || !ok2 {
+		return 0
+	}
+
+	if percentage {
+		p1, p2 := rm1.percent(q1), rm2.percent(q2)
+		switch {
+		case p1 < p2:
+			return -1
+		case p1 > p2:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return q1.Cmp(q2)
+}
+
+func (rm *resourceMetric) metricQuantity(metric string) (resource.Quantity, bool) {
+	switch metric {
+	case "util":
+		return rm.utilization, true
+	case "request":
+		return rm.request, true
+	case "limit":
+		return rm.limit, true
+	default:
+		return resource.Quantity{}, false
+	}
+}
+
 func (rm *resourceMetric) requestString(availableFormat bool) string {
 	return resourceString(rm.resourceType, rm.request, rm.allocatable, availableFormat)
 }
@@ -379,6 +740,12 @@ func (rm *resourceMetric) utilString(availableFormat bool) string {
 	return resourceString(rm.resourceType, rm.utilization, rm.allocatable, availableFormat)
 }
 
+// overheadString is always a percentage, as the amount available makes no
+// sense for overhead.
+func (rm *resourceMetric) overheadString() string {
+	return resourceString(rm.resourceType, rm.overhead, rm.allocatable, false)
+}
+
 // podCountString returns the string representation of podCount struct, example: "15/110"
 func (pc *podCount) podCountString() string {
 	return fmt.Sprintf("%d/%d", pc.current, pc.allocatable)
@@ -390,35 +757,63 @@ func resourceString(resourceType string, actual, allocatable resource.Quantity,
 		utilPercent = float64(actual.MilliValue()) / float64(allocatable.MilliValue()) * 100
 	}
 
-	var actualStr, allocatableStr string
-
 	if availableFormat {
-		switch resourceType {
-		case "cpu":
-			actualStr = fmt.Sprintf("%dm", allocatable.MilliValue()-actual.MilliValue())
-			allocatableStr = fmt.Sprintf("%dm", allocatable.MilliValue())
-		case "memory":
-			actualStr = fmt.Sprintf("%dMi", formatToMegiBytes(allocatable)-formatToMegiBytes(actual))
-			allocatableStr = fmt.Sprintf("%dMi", formatToMegiBytes(allocatable))
+		var availableStr string
+		switch {
+		case resourceType == "cpu":
+			availableStr = fmt.Sprintf("%dm", allocatable.MilliValue()-actual.MilliValue())
+		case isByteResource(resourceType):
+			availableStr = fmt.Sprintf("%dMi", formatToMegiBytes(allocatable)-formatToMegiBytes(actual))
 		default:
-			actualStr = fmt.Sprintf("%d", allocatable.Value()-actual.Value())
-			allocatableStr = fmt.Sprintf("%d", allocatable.Value())
+			availableStr = fmt.Sprintf("%d", allocatable.Value()-actual.Value())
 		}
 
-		return fmt.Sprintf("%s/%s", actualStr, allocatableStr)
+		return fmt.Sprintf("%s/%s", availableStr, formatQuantity(resourceType, allocatable))
 	}
 
-	switch resourceType {
-	case "cpu":
-		actualStr = fmt.Sprintf("%dm", actual.MilliValue())
-	case "memory":
-		actualStr = fmt.Sprintf("%dMi", formatToMegiBytes(actual))
+	return fmt.Sprintf("%s (%d%%%%)", formatQuantity(resourceType, actual), int64(utilPercent))
+
+}
+
+// formatQuantity renders a quantity in the unit used for its resource type:
+// millicores for CPU, mebibytes for byte based resources and whole units for
+// everything else.
+func formatQuantity(resourceType string, q resource.Quantity) string {
+	switch {
+	case resourceType == "cpu":
+		return fmt.Sprintf("%dm", q.MilliValue())
+	case isByteResource(resourceType):
+		return fmt.Sprintf("%dMi", formatToMegiBytes(q))
 	default:
-		actualStr = fmt.Sprintf("%d", actual.Value())
+		return fmt.Sprintf("%d", q.Value())
 	}
+}
 
-	return fmt.Sprintf("%s (%d%%%%)", actualStr, int64(utilPercent))
+// isByteResource returns true for resources that are measured in bytes.
+func isByteResource(resourceType string) bool {
+	return resourceType == "memory" ||
+		resourceType == string(corev1.ResourceEphemeralStorage) ||
+		strings.HasPrefix(resourceType, corev1.ResourceHugePagesPrefix)
+}
+
+// rawUnit returns the unit rawValue reports a resource in.
+func rawUnit(resourceType string) string {
+	if resourceType == "cpu" {
+		return "millicores"
+	}
+	if isByteResource(resourceType) {
+		return "bytes"
+	}
+	return ""
+}
 
+// rawValue returns a quantity as an integer, in millicores for CPU and in
+// bytes or units for other resources.
+func rawValue(resourceType string, q resource.Quantity) int64 {
+	if resourceType == "cpu" {
+		return q.MilliValue()
+	}
+	return q.Value()
 }
 
 func formatToMegiBytes(actual resource.Quantity) int64 {
@@ -431,15 +826,8 @@ func formatToMegiBytes(actual resource.Quantity) int64 {
 
 // NOTE: This might not be a great place for closures due to the cyclical nature of how resourceType works. Perhaps better implemented another way.
 func (rm resourceMetric) valueFunction() (f func(r resource.Quantity) string) {
-	switch rm.resourceType {
-	case "cpu":
-		f = func(r resource.Quantity) string {
-			return fmt.Sprintf("%dm", r.MilliValue())
-		}
-	case "memory":
-		f = func(r resource.Quantity) string {
-			return fmt.Sprintf("%dMi", formatToMegiBytes(r))
-		}
+	f = func(r resource.Quantity) string {
+		return formatQuantity(rm.resourceType, r)
 	}
 	return f
 }
@@ -453,5 +841,8 @@ func (rm resourceMetric) percentFunction() (f func(r resource.Quantity) string)
 }
 
 func (rm resourceMetric) percent(r resource.Quantity) int64 {
+	if rm.allocatable.MilliValue() == 0 {
+		return 0
+	}
 	return int64(float64(r.MilliValue()) / float64(rm.allocatable.MilliValue()) * 100)
 }
@@ -28,23 +28,26 @@ import (
 
 func TestBuildClusterMetricEmpty(t *testing.T) {
 	cm := buildClusterMetric(
-		&corev1.PodList{}, &v1beta1.PodMetricsList{}, &corev1.NodeList{}, &v1beta1.NodeMetricsList{},
+		&corev1.PodList{}, &v1beta1.PodMetricsList{}, &corev1.NodeList{}, &v1beta1.NodeMetricsList{}, DefaultResources,
 	)
 
 	expected := clusterMetric{
-		cpu: &resourceMetric{
-			resourceType: "cpu",
-			allocatable:  resource.Quantity{},
-			request:      resource.Quantity{},
-			limit:        resource.Quantity{},
-			utilization:  resource.Quantity{},
-		},
-		memory: &resourceMetric{
-			resourceType: "memory",
-			allocatable:  resource.Quantity{},
-			request:      resource.Quantity{},
-			limit:        resource.Quantity{},
-			utilization:  resource.Quantity{},
+		resourceNames: DefaultResources,
+		resources: resourceMetrics{
+			"cpu": &resourceMetric{
+				resourceType: "cpu",
+				allocatable:  resource.Quantity{},
+				request:      resource.Quantity{},
+				limit:        resource.Quantity{},
+				utilization:  resource.Quantity{},
+			},
+			"memory": &resourceMetric{
+				resourceType: "memory",
+				allocatable:  resource.Quantity{},
+				request:      resource.Quantity{},
+				limit:        resource.Quantity{},
+				utilization:  resource.Quantity{},
+			},
 		},
 		nodeMetrics: map[string]*nodeMetric{},
 		podCount:    &podCount{},
@@ -53,6 +56,26 @@ func TestBuildClusterMetricEmpty(t *testing.T) {
 	assert.EqualValues(t, cm, expected)
 }
 
+func TestBuildClusterMetricPodCount(t *testing.T) {
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	db := groupTestPod("example-node-2", "default", "db", "300m", "300m")
+	job := groupTestPod("example-node-2", "default", "job", "100m", "100m")
+	job.Status.Phase = corev1.PodSucceeded
+	orphan := groupTestPod("example-node-9", "default", "orphan", "100m", "100m")
+
+	cm := buildClusterMetric(
+		&corev1.PodList{Items: []corev1.Pod{web, db, job, orphan}}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1"), groupTestNode("example-node-2")}}, nil,
+		DefaultResources,
+	)
+
+	assert.Equal(t, &podCount{current: 2, allocatable: 220}, cm.podCount)
+	assert.Equal(t, &podCount{current: 1, allocatable: 110}, cm.nodeMetrics["example-node-1"].podCount)
+	assert.Equal(t, &podCount{current: 1, allocatable: 110}, cm.nodeMetrics["example-node-2"].podCount)
+	assert.Len(t, cm.nodeMetrics["example-node-2"].podMetrics, 1)
+	assert.Equal(t, int64(500), cm.resources["cpu"].request.MilliValue())
+}
+
 func TestBuildClusterMetricFull(t *testing.T) {
 	cm := buildClusterMetric(
 		&corev1.PodList{
@@ -143,6 +166,7 @@ func TestBuildClusterMetricFull(t *testing.T) {
 				},
 			},
 		},
+		DefaultResources,
 	)
 
 	cpuExpected := &resourceMetric{
@@ -159,16 +183,16 @@ func TestBuildClusterMetricFull(t *testing.T) {
 		utilization: resource.MustParse("349Mi"),
 	}
 
-	assert.NotNil(t, cm.cpu)
-	ensureEqualResourceMetric(t, cm.cpu, cpuExpected)
-	assert.NotNil(t, cm.memory)
-	ensureEqualResourceMetric(t, cm.memory, memoryExpected)
+	assert.NotNil(t, cm.resources["cpu"])
+	ensureEqualResourceMetric(t, cm.resources["cpu"], cpuExpected)
+	assert.NotNil(t, cm.resources["memory"])
+	ensureEqualResourceMetric(t, cm.resources["memory"], memoryExpected)
 
 	assert.NotNil(t, cm.nodeMetrics["example-node-1"])
-	assert.NotNil(t, cm.nodeMetrics["example-node-1"].cpu)
-	ensureEqualResourceMetric(t, cm.nodeMetrics["example-node-1"].cpu, cpuExpected)
-	assert.NotNil(t, cm.nodeMetrics["example-node-1"].memory)
-	ensureEqualResourceMetric(t, cm.nodeMetrics["example-node-1"].memory, memoryExpected)
+	assert.NotNil(t, cm.nodeMetrics["example-node-1"].resources["cpu"])
+	ensureEqualResourceMetric(t, cm.nodeMetrics["example-node-1"].resources["cpu"], cpuExpected)
+	assert.NotNil(t, cm.nodeMetrics["example-node-1"].resources["memory"])
+	ensureEqualResourceMetric(t, cm.nodeMetrics["example-node-1"].resources["memory"], memoryExpected)
 
 	assert.Len(t, cm.nodeMetrics["example-node-1"].podMetrics, 1)
 
@@ -178,10 +202,190 @@ func TestBuildClusterMetricFull(t *testing.T) {
 	memoryExpected.utilization = resource.MustParse("299Mi")
 
 	assert.NotNil(t, pm["default-example-pod"])
-	assert.NotNil(t, pm["default-example-pod"].cpu)
-	ensureEqualResourceMetric(t, pm["default-example-pod"].cpu, cpuExpected)
-	assert.NotNil(t, pm["default-example-pod"].memory)
-	ensureEqualResourceMetric(t, pm["default-example-pod"].memory, memoryExpected)
+	assert.NotNil(t, pm["default-example-pod"].resources["cpu"])
+	ensureEqualResourceMetric(t, pm["default-example-pod"].resources["cpu"], cpuExpected)
+	assert.NotNil(t, pm["default-example-pod"].resources["memory"])
+	ensureEqualResourceMetric(t, pm["default-example-pod"].resources["memory"], memoryExpected)
+}
+
+func TestBuildClusterMetricExtendedResources(t *testing.T) {
+	cm := buildClusterMetric(
+		&corev1.PodList{
+			Items: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "example-pod",
+						Namespace: "default",
+					},
+					Spec: corev1.PodSpec{
+						NodeName: "example-node-1",
+						Containers: []corev1.Container{
+							{
+								Name: "example-container",
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{
+										"cpu":            resource.MustParse("250m"),
+										"nvidia.com/gpu": resource.MustParse("1"),
+									},
+									Limits: corev1.ResourceList{
+										"nvidia.com/gpu": resource.MustParse("1"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}, nil, &corev1.NodeList{
+			Items: []corev1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "example-node-1",
+					},
+					Status: corev1.NodeStatus{
+						Allocatable: corev1.ResourceList{
+							"cpu":            resource.MustParse("1000m"),
+							"nvidia.com/gpu": resource.MustParse("4"),
+						},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "example-node-2",
+					},
+					Status: corev1.NodeStatus{
+						Allocatable: corev1.ResourceList{
+							"cpu": resource.MustParse("1000m"),
+						},
+					},
+				},
+			},
+		}, nil, []string{"nvidia.com/gpu"},
+	)
+
+	assert.Len(t, cm.resources, 1)
+	ensureEqualResourceMetric(t, cm.resources["nvidia.com/gpu"], &resourceMetric{
+		allocatable: resource.MustParse("4"),
+		request:     resource.MustParse("1"),
+		limit:       resource.MustParse("1"),
+	})
+
+	nm := cm.nodeMetrics["example-node-2"]
+	assert.Equal(t, "0 (0%%)", nm.resources["nvidia.com/gpu"].requestString(false))
+
+	ctm := cm.nodeMetrics["example-node-1"].podMetrics["default-example-pod"].containerMetrics["example-container"]
+	assert.Equal(t, "1 (25%%)", ctm.resources["nvidia.com/gpu"].requestString(false))
+	assert.Equal(t, "3/4", ctm.resources["nvidia.com/gpu"].requestString(true))
+}
+
+func TestBuildClusterMetricContainerTypes(t *testing.T) {
+	pod := groupTestPod("example-node-1", "default", "web", "100m", "100m")
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name: "proxy",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("200m")},
+		},
+	})
+	pod.Spec.InitContainers = []corev1.Container{
+		{Name: "migrate", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("500m")},
+		}},
+		{Name: "setup", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("50m")},
+		}},
+	}
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}},
+	}
+	pod.Spec.Overhead = corev1.ResourceList{"cpu": resource.MustParse("50m")}
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{pod}}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}, nil, DefaultResources)
+	pm := cm.nodeMetrics["example-node-1"].podMetrics["default-web"]
+
+	types := map[string]string{}
+	for _, ctm := range pm.containerMetrics {
+		types[ctm.name] = ctm.containerType
+	}
+	assert.Equal(t, map[string]string{
+		"web":      appContainerType,
+		"proxy":    appContainerType,
+		"migrate":  initContainerType,
+		"setup":    initContainerType,
+		"debugger": ephemeralContainerType,
+	}, types)
+
+	// The largest init container needs more than the app containers combined.
+	rb := pm.requestBreakdown("cpu")
+	assert.Equal(t, int64(300), rb.containers.MilliValue())
+	assert.Equal(t, int64(500), rb.initContainers.MilliValue())
+	assert.Equal(t, int64(50), rb.overhead.MilliValue())
+	assert.Equal(t, int64(550), rb.effective.MilliValue())
+}
+
+func TestBuildClusterMetricSidecars(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	pod := groupTestPod("example-node-1", "default", "web", "200m", "200m")
+	pod.Spec.InitContainers = []corev1.Container{
+		{Name: "setup", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("300m")},
+		}},
+		{Name: "proxy", RestartPolicy: &always, Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("100m")},
+		}},
+		{Name: "migrate", Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{"cpu": resource.MustParse("500m")},
+		}},
+	}
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{pod}}, nil,
+		&corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}, nil, DefaultResources)
+	pm := cm.nodeMetrics["example-node-1"].podMetrics["default-web"]
+
+	types := map[string]string{}
+	for _, ctm := range pm.containerMetrics {
+		types[ctm.name] = ctm.containerType
+	}
+	assert.Equal(t, map[string]string{
+		"web":     appContainerType,
+		"setup":   initContainerType,
+		"proxy":   sidecarContainerType,
+		"migrate": initContainerType,
+	}, types)
+
+	// The sidecar keeps running while migrate starts after it, but not while
+	// setup runs before it.
+	rb := pm.requestBreakdown("cpu")
+	assert.Equal(t, int64(200), rb.containers.MilliValue())
+	assert.Equal(t, int64(100), rb.sidecars.MilliValue())
+	assert.Equal(t, int64(600), rb.initContainers.MilliValue())
+	assert.Equal(t, int64(600), rb.effective.MilliValue())
+
+	// The pod request agrees with the request breakdown.
+	assert.Equal(t, int64(600), pm.resources["cpu"].request.MilliValue())
+}
+
+func TestParseSortAttribute(t *testing.T) {
+	var testCases = []struct {
+		sortBy       string
+		resourceName string
+		metric       string
+		percentage   bool
+	}{
+		{"cpu.util", "cpu", "util", false},
+		{"mem.request.percentage", "memory", "request", true},
+		{"nvidia.com/gpu.limit", "nvidia.com/gpu", "limit", false},
+		{"name", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.sortBy, func(t *testing.T) {
+			resourceName, metric, percentage := parseSortAttribute(tc.sortBy)
+			assert.Equal(t, tc.resourceName, resourceName)
+			assert.Equal(t, tc.metric, metric)
+			assert.Equal(t, tc.percentage, percentage)
+		})
+	}
 }
 
 func ensureEqualResourceMetric(t *testing.T, actual *resourceMetric, expected *resourceMetric) {
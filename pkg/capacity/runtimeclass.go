@@ -0,0 +1,70 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import "sort"
+
+// runtimeClassMetric holds the totals for the scheduled pods using a
+// RuntimeClass, so that the overhead of sandboxed runtimes is visible.
+// Allocatable is that of the whole cluster.
+type runtimeClassMetric struct {
+	name      string
+	podCount  int64
+	resources resourceMetrics
+}
+
+// getSortedRuntimeClassMetrics returns the totals for each RuntimeClass in
+// use, sorted by name. Pods without a RuntimeClass are left out.
+func (cm *clusterMetric) getSortedRuntimeClassMetrics() []*runtimeClassMetric {
+	runtimeClassMetrics := map[string]*runtimeClassMetric{}
+
+	for _, nm := range cm.nodeMetrics {
+		for _, pm := range nm.podMetrics {
+			if pm.runtimeClass == "" {
+				continue
+			}
+
+			rcm, ok := runtimeClassMetrics[pm.runtimeClass]
+			if !ok {
+				rcm = &runtimeClassMetric{
+					name:      pm.runtimeClass,
+					resources: newResourceMetrics(cm.resourceNames),
+				}
+				for name, rm := range rcm.resources {
+					rm.allocatable = cm.resources[name].allocatable
+				}
+				runtimeClassMetrics[pm.runtimeClass] = rcm
+			}
+
+			rcm.podCount++
+			for name, rm := range rcm.resources {
+				rm.request.Add(pm.resources[name].request)
+				rm.limit.Add(pm.resources[name].limit)
+				rm.overhead.Add(pm.resources[name].overhead)
+				rm.utilization.Add(pm.resources[name].utilization)
+			}
+		}
+	}
+
+	sorted := make([]*runtimeClassMetric, 0, len(runtimeClassMetrics))
+	for _, rcm := range runtimeClassMetrics {
+		sorted = append(sorted, rcm)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	return sorted
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serveShutdownTimeout is how long in-flight scrapes are given to finish once
+// the server is asked to stop.
+const serveShutdownTimeout = 5 * time.Second
+
+// exporter periodically rebuilds Prometheus metrics from informer caches so
+// that scrapes never trigger requests to the API server.
+type exporter struct {
+	collector *informerCollector
+	log       io.Writer
+
+	mu      sync.RWMutex
+	metrics []byte
+}
+
+// Serve exposes cluster resource data as Prometheus metrics on /metrics,
+// refreshing them every interval. Progress, warnings and errors refreshing
+// the metrics are written to log. It returns when serving fails or once the
+// context is cancelled and the server has shut down.
+func Serve(ctx context.Context, log io.Writer, opts Options, listen string, interval time.Duration) error {
+	collector, err := newInformerCollector(opts)
+	if err != nil {
+		return err
+	}
+	// Metrics without utilization are more useful to scrape than none, so
+	// any error getting it is logged rather than failing the refresh.
+	collector.tolerateMetricsError = func(error) bool { return true }
+
+	if err := collector.start(ctx); err != nil {
+		return err
+	}
+
+	e := &exporter{collector: collector, log: log}
+	e.refresh(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.refresh(ctx)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{Addr: listen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(log, "Serving metrics on %s/metrics\n", listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("Error serving metrics: %v", err)
+	}
+	return nil
+}
+
+// refresh rebuilds the metrics from the informer caches and, if enabled, the
+// Metrics API.
+func (e *exporter) refresh(ctx context.Context) {
+	cc, err := e.collector.collect(ctx)
+	if err != nil {
+		fmt.Fprintf(e.log, "Error collecting metrics: %v\n", err)
+		return
+	}
+	for _, warning := range cc.Warnings() {
+		fmt.Fprintf(e.log, "Warning: %v\n", warning)
+	}
+
+	body := buildPromMetrics(&cc.cm, cc.options.Utilization).bytes()
+
+	e.mu.Lock()
+	e.metrics = body
+	e.mu.Unlock()
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := w.Write(e.metrics)
+	if err != nil {
+		fmt.Fprintf(e.log, "Error writing metrics: %v\n", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// The types below mirror the subset of the kubelet summary API
+// (/stats/summary) needed to report ephemeral storage usage, which is not
+// exposed by metrics-server.
+type statsSummary struct {
+	Node statsNode  `json:"node"`
+	Pods []statsPod `json:"pods"`
+}
+
+type statsNode struct {
+	NodeName string   `json:"nodeName"`
+	Fs       *statsFs `json:"fs,omitempty"`
+}
+
+type statsPod struct {
+	PodRef           statsPodRef      `json:"podRef"`
+	Containers       []statsContainer `json:"containers"`
+	EphemeralStorage *statsFs         `json:"ephemeral-storage,omitempty"`
+}
+
+type statsPodRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type statsContainer struct {
+	Name   string   `json:"name"`
+	Rootfs *statsFs `json:"rootfs,omitempty"`
+	Logs   *statsFs `json:"logs,omitempty"`
+}
+
+type statsFs struct {
+	UsedBytes *uint64 `json:"usedBytes,omitempty"`
+}
+
+func (fs *statsFs) usedQuantity() resource.Quantity {
+	if fs == nil || fs.UsedBytes == nil {
+		return resource.Quantity{}
+	}
+	return *resource.NewQuantity(int64(*fs.UsedBytes), resource.BinarySI)
+}
+
+// summaryWorkers bounds how many kubelet summaries are requested at once.
+const summaryWorkers = 16
+
+// addEphemeralStorageMetrics queries the kubelet summary API of every node
+// and merges ephemeral storage usage into the pod and node metrics lists. The
+// usage of each pod as a whole, which includes volumes such as emptyDir that
+// are not part of any container, is returned keyed by "namespace-name".
+// Nodes that cannot be queried are skipped and returned as warnings.
+func addEphemeralStorageMetrics(ctx context.Context, clientset kubernetes.Interface, nodeNames []string,
+	pmList *v1beta1.PodMetricsList, nmList *v1beta1.NodeMetricsList) (map[string]resource.Quantity, []error) {
+	summaries := make([]*statsSummary, len(nodeNames))
+	errs := make([]error, len(nodeNames))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < summaryWorkers && w < len(nodeNames); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				summaries[i], errs[i] = getStatsSummary(ctx, clientset, nodeNames[i])
+			}
+		}()
+	}
+	for i := range nodeNames {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	podUsage := map[string]resource.Quantity{}
+	warnings := []error{}
+	for i, nodeName := range nodeNames {
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Errorf("Error getting ephemeral storage usage for Node %s: %v", nodeName, errs[i]))
+			continue
+		}
+
+		mergeStatsSummary(summaries[i], pmList, nmList, podUsage)
+	}
+
+	return podUsage, warnings
+}
+
+func getStatsSummary(ctx context.Context, clientset kubernetes.Interface, nodeName string) (*statsSummary, error) {
+	reqCtx, cancel := requestContext(ctx)
+	defer cancel()
+
+	raw, err := clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("stats/summary").
+		DoRaw(reqCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &statsSummary{}
+	if err := json.Unmarshal(raw, summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func mergeStatsSummary(summary *statsSummary, pmList *v1beta1.PodMetricsList, nmList *v1beta1.NodeMetricsList,
+	podUsage map[string]resource.Quantity) {
+	if nmList != nil {
+		for i := range nmList.Items {
+			nm := &nmList.Items[i]
+			if nm.Name == summary.Node.NodeName {
+				if nm.Usage == nil {
+					nm.Usage = corev1.ResourceList{}
+				}
+				nm.Usage[corev1.ResourceEphemeralStorage] = summary.Node.Fs.usedQuantity()
+			}
+		}
+	}
+
+	if pmList == nil {
+		return
+	}
+
+	podIndex := map[string]int{}
+	for i, pm := range pmList.Items {
+		podIndex[fmt.Sprintf("%s-%s", pm.GetNamespace(), pm.GetName())] = i
+	}
+
+	for _, sp := range summary.Pods {
+		key := fmt.Sprintf("%s-%s", sp.PodRef.Namespace, sp.PodRef.Name)
+		if sp.EphemeralStorage != nil {
+			podUsage[key] = sp.EphemeralStorage.usedQuantity()
+		}
+
+		i, ok := podIndex[key]
+		if !ok {
+			pmList.Items = append(pmList.Items, v1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      sp.PodRef.Name,
+					Namespace: sp.PodRef.Namespace,
+				},
+			})
+			i = len(pmList.Items) - 1
+			podIndex[key] = i
+		}
+		pm := &pmList.Items[i]
+
+		for _, sc := range sp.Containers {
+			usage := sc.Rootfs.usedQuantity()
+			usage.Add(sc.Logs.usedQuantity())
+
+			found := false
+			for i := range pm.Containers {
+				if pm.Containers[i].Name == sc.Name {
+					if pm.Containers[i].Usage == nil {
+						pm.Containers[i].Usage = corev1.ResourceList{}
+					}
+					pm.Containers[i].Usage[corev1.ResourceEphemeralStorage] = usage
+					found = true
+				}
+			}
+
+			if !found {
+				pm.Containers = append(pm.Containers, v1beta1.ContainerMetrics{
+					Name:  sc.Name,
+					Usage: corev1.ResourceList{corev1.ResourceEphemeralStorage: usage},
+				})
+			}
+		}
+	}
+}
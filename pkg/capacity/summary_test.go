@@ -0,0 +1,136 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const testStatsSummary = `{
+  "node": {
+    "nodeName": "example-node-1",
+    "fs": {"usedBytes": 2147483648}
+  },
+  "pods": [
+    {
+      "podRef": {"name": "example-pod", "namespace": "default"},
+      "containers": [
+        {
+          "name": "example-container",
+          "rootfs": {"usedBytes": 104857600},
+          "logs": {"usedBytes": 10485760}
+        }
+      ],
+      "ephemeral-storage": {"usedBytes": 524288000}
+    },
+    {
+      "podRef": {"name": "other-pod", "namespace": "default"},
+      "containers": [
+        {
+          "name": "other-container",
+          "rootfs": {"usedBytes": 1048576}
+        }
+      ]
+    }
+  ]
+}`
+
+func TestMergeStatsSummary(t *testing.T) {
+	summary := &statsSummary{}
+	err := json.Unmarshal([]byte(testStatsSummary), summary)
+	assert.NoError(t, err)
+
+	pmList := &v1beta1.PodMetricsList{
+		Items: []v1beta1.PodMetrics{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "example-pod",
+					Namespace: "default",
+				},
+				Containers: []v1beta1.ContainerMetrics{
+					{
+						Name: "example-container",
+						Usage: corev1.ResourceList{
+							"cpu": resource.MustParse("10m"),
+						},
+					},
+				},
+			},
+		},
+	}
+	nmList := &v1beta1.NodeMetricsList{
+		Items: []v1beta1.NodeMetrics{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "example-node-1",
+				},
+				Usage: corev1.ResourceList{
+					"cpu": resource.MustParse("43m"),
+				},
+			},
+		},
+	}
+
+	podUsage := map[string]resource.Quantity{}
+	mergeStatsSummary(summary, pmList, nmList, podUsage)
+
+	nodeUsage := nmList.Items[0].Usage[corev1.ResourceEphemeralStorage]
+	assert.Equal(t, int64(2048*Mebibyte), nodeUsage.Value())
+
+	assert.Len(t, pmList.Items, 2)
+	container := pmList.Items[0].Containers[0]
+	containerUsage := container.Usage[corev1.ResourceEphemeralStorage]
+	assert.Equal(t, int64(110*Mebibyte), containerUsage.Value())
+	assert.Equal(t, int64(10), container.Usage.Cpu().MilliValue())
+
+	other := pmList.Items[1]
+	assert.Equal(t, "other-pod", other.Name)
+	otherUsage := other.Containers[0].Usage[corev1.ResourceEphemeralStorage]
+	assert.Equal(t, int64(Mebibyte), otherUsage.Value())
+
+	// Only pods reporting usage as a whole, including their volumes, have it.
+	assert.Len(t, podUsage, 1)
+	podTotal := podUsage["default-example-pod"]
+	assert.Equal(t, int64(500*Mebibyte), podTotal.Value())
+}
+
+func TestAddPodStorage(t *testing.T) {
+	nodeList := &corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}
+	pod := groupTestPod("example-node-1", "default", "web", "100m", "100m")
+	podMetrics := map[string]v1beta1.PodMetrics{
+		"default-web": {
+			Containers: []v1beta1.ContainerMetrics{{
+				Name:  "web",
+				Usage: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("110Mi")},
+			}},
+		},
+	}
+
+	cm := newClusterMetric(nodeList, nil, []string{"cpu", "ephemeral-storage"})
+	cm.podStorage = map[string]resource.Quantity{"default-web": resource.MustParse("500Mi")}
+	cm.addPod(&pod, podMetrics)
+
+	pm := cm.nodeMetrics["example-node-1"].podMetrics["default-web"]
+	assert.Equal(t, int64(500*Mebibyte), pm.resources["ephemeral-storage"].utilization.Value())
+	assert.Equal(t, int64(110*Mebibyte), pm.containerMetrics["web"].resources["ephemeral-storage"].utilization.Value())
+}
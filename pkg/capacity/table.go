@@ -16,61 +16,145 @@ package capacity
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"strings"
 	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/duration"
 )
 
 type tablePrinter struct {
-	cm              *clusterMetric
-	showPods        bool
-	showUtil        bool
-	showPodCount    bool
-	showContainers  bool
-	showNamespace   bool
-	sortBy          string
-	w               *tabwriter.Writer
-	availableFormat bool
+	cm               *clusterMetric
+	showPods         bool
+	showUtil         bool
+	showOverhead     bool
+	showPodCount     bool
+	showContainers   bool
+	showNamespace    bool
+	sortBy           string
+	groupBy          string
+	groupByNodeLabel string
+	w                *tabwriter.Writer
+	availableFormat  bool
+	diff             *tableDiff
+
+	// lines collects the items of each line instead of writing them, for
+	// printers that render the same table in other formats.
+	lines *[][]string
 }
 
 type tableLine struct {
-	node           string
-	namespace      string
-	pod            string
-	container      string
-	cpuRequests    string
-	cpuLimits      string
-	cpuUtil        string
-	memoryRequests string
-	memoryLimits   string
-	memoryUtil     string
-	podCount       string
-}
-
-var headerStrings = tableLine{
-	node:           "NODE",
-	namespace:      "NAMESPACE",
-	pod:            "POD",
-	container:      "CONTAINER",
-	cpuRequests:    "CPU REQUESTS",
-	cpuLimits:      "CPU LIMITS",
-	cpuUtil:        "CPU UTIL",
-	memoryRequests: "MEMORY REQUESTS",
-	memoryLimits:   "MEMORY LIMITS",
-	memoryUtil:     "MEMORY UTIL",
-	podCount:       "POD COUNT",
-}
-
-func (tp *tablePrinter) Print() {
-	tp.w.Init(os.Stdout, 0, 8, 2, ' ', 0)
-	sortedNodeMetrics := tp.cm.getSortedNodeMetrics(tp.sortBy)
+	nodeGroup     string
+	node          string
+	namespace     string
+	pod           string
+	container     string
+	containerType string
+	workload      string
+	replicas      string
+	resources     map[string]*resourceLine
+	podCount      string
+	age           string
+	reason        string
+}
 
-	tp.printLine(&headerStrings)
+type resourceLine struct {
+	requests string
+	limits   string
+	overhead string
+	util     string
+}
+
+func (tp *tablePrinter) Print(out io.Writer) error {
+	tp.w.Init(out, 0, 8, 2, ' ', 0)
+
+	tp.printLine(tp.headerLine())
+	tp.printBody()
+
+	if err := tp.w.Flush(); err != nil {
+		return err
+	}
+
+	if tp.showOverhead {
+		return tp.printRuntimeClasses(out)
+	}
+	return nil
+}
+
+// printRuntimeClasses prints the totals for each RuntimeClass in use below
+// the table, as they do not fit its columns.
+func (tp *tablePrinter) printRuntimeClasses(out io.Writer) error {
+	runtimeClassMetrics := tp.cm.getSortedRuntimeClassMetrics()
+	if len(runtimeClassMetrics) == 0 {
+		return nil
+	}
+
+	header := &tableLine{resources: tp.headerLine().resources}
+	lines := [][]string{append([]string{"RUNTIME CLASS", "PODS"}, tp.resourceItems(header)...)}
+	for _, rcm := range runtimeClassMetrics {
+		tl := &tableLine{resources: tp.resourceLines(rcm.resources)}
+		lines = append(lines, append([]string{rcm.name, fmt.Sprintf("%d", rcm.podCount)}, tp.resourceItems(tl)...))
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w)
+	for _, lineItems := range lines {
+		fmt.Fprintf(w, strings.Join(lineItems, "\t ")+"\n")
+	}
+	return w.Flush()
+}
+
+// getLines returns the items of each line of the table, starting with the
+// header. Blank separator lines are left out and percent signs are not
+// escaped.
+func (tp *tablePrinter) getLines() [][]string {
+	lines := [][]string{}
+	tp.lines = &lines
+	defer func() { tp.lines = nil }()
+
+	tp.printLine(tp.headerLine())
+	tp.printBody()
+
+	return lines
+}
+
+func (tp *tablePrinter) printBody() {
+	if groupsPods(tp.groupBy) {
+		tp.printGroups()
+	} else {
+		tp.printNodes()
+	}
+}
+
+func (tp *tablePrinter) printNodes() {
+	sortedNodeMetrics := tp.cm.getSortedNodeMetrics(tp.sortBy)
 
 	if len(sortedNodeMetrics) > 1 {
 		tp.printClusterLine()
 	}
 
+	if tp.groupByNodeLabel == "" {
+		tp.printNodeMetrics(sortedNodeMetrics)
+	} else {
+		for _, ngm := range tp.cm.getSortedNodeGroupMetrics(tp.groupByNodeLabel, tp.sortBy) {
+			tp.printLine(&tableLine{})
+			tp.printNodeGroupLine(ngm)
+			tp.printNodeMetrics(ngm.getSortedNodeMetrics(tp.sortBy))
+		}
+	}
+
+	// Pending pods are printed last, as if on a node of their own.
+	if tp.cm.pending != nil {
+		if tp.groupByNodeLabel != "" && !tp.showPods && !tp.showContainers {
+			tp.printLine(&tableLine{})
+		}
+		tp.printNodeMetrics([]*nodeMetric{tp.cm.pending})
+	}
+}
+
+func (tp *tablePrinter) printNodeMetrics(sortedNodeMetrics []*nodeMetric) {
 	for _, nm := range sortedNodeMetrics {
 		if tp.showPods || tp.showContainers {
 			tp.printLine(&tableLine{})
@@ -91,111 +175,286 @@ func (tp *tablePrinter) Print() {
 			}
 		}
 	}
+}
+
+func (tp *tablePrinter) printGroups() {
+	sortedGroupMetrics := tp.cm.getSortedGroupMetrics(tp.groupBy, tp.sortBy)
+
+	if len(sortedGroupMetrics) > 1 {
+		tp.printClusterLine()
+	}
+
+	for _, gm := range sortedGroupMetrics {
+		if tp.showPods || tp.showContainers {
+			tp.printLine(&tableLine{})
+		}
+
+		tp.printGroupLine(gm)
 
-	err := tp.w.Flush()
-	if err != nil {
-		fmt.Printf("Error writing to table: %s", err)
+		if tp.showPods || tp.showContainers {
+			for _, pm := range gm.getSortedPodMetrics(tp.sortBy) {
+				tp.printPodLine("", pm)
+				if tp.showContainers {
+					for _, containerMetric := range pm.getSortedContainerMetrics(tp.sortBy) {
+						tp.printContainerLine("", pm, containerMetric)
+					}
+				}
+			}
+		}
 	}
 }
 
 func (tp *tablePrinter) printLine(tl *tableLine) {
 	lineItems := tp.getLineItems(tl)
+	if tp.lines != nil {
+		if !isBlankLine(lineItems) {
+			for i, item := range lineItems {
+				lineItems[i] = strings.ReplaceAll(item, "%%", "%")
+			}
+			*tp.lines = append(*tp.lines, lineItems)
+		}
+		return
+	}
+	if tp.diff != nil {
+		lineItems = tp.diff.highlight(tl.key(), lineItems)
+	}
 	fmt.Fprintf(tp.w, strings.Join(lineItems[:], "\t ")+"\n")
 }
 
+func isBlankLine(lineItems []string) bool {
+	for _, item := range lineItems {
+		if item != "" {
+			return false
+		}
+	}
+	return true
+}
+
 func (tp *tablePrinter) getLineItems(tl *tableLine) []string {
-	lineItems := []string{tl.node}
+	var lineItems []string
 
-	if tp.showContainers || tp.showPods {
-		if tp.showNamespace {
-			lineItems = append(lineItems, tl.namespace)
+	switch tp.groupBy {
+	case NamespaceGrouping:
+		lineItems = []string{tl.namespace}
+
+		if tp.showContainers || tp.showPods {
+			lineItems = append(lineItems, tl.pod)
+		}
+	case WorkloadGrouping:
+		lineItems = []string{tl.namespace, tl.workload, tl.replicas}
+
+		if tp.showContainers || tp.showPods {
+			lineItems = append(lineItems, tl.pod)
+		}
+	default:
+		if tp.groupByNodeLabel != "" {
+			lineItems = append(lineItems, tl.nodeGroup)
+		}
+		lineItems = append(lineItems, tl.node)
+
+		if tp.showContainers || tp.showPods {
+			if tp.showNamespace {
+				lineItems = append(lineItems, tl.namespace)
+			}
+			lineItems = append(lineItems, tl.pod)
 		}
-		lineItems = append(lineItems, tl.pod)
 	}
 
 	if tp.showContainers {
-		lineItems = append(lineItems, tl.container)
+		lineItems = append(lineItems, tl.container, tl.containerType)
 	}
 
-	lineItems = append(lineItems, tl.cpuRequests)
-	lineItems = append(lineItems, tl.cpuLimits)
+	lineItems = append(lineItems, tp.resourceItems(tl)...)
 
-	if tp.showUtil {
-		lineItems = append(lineItems, tl.cpuUtil)
+	if tp.showPodCount {
+		lineItems = append(lineItems, tl.podCount)
 	}
 
-	lineItems = append(lineItems, tl.memoryRequests)
-	lineItems = append(lineItems, tl.memoryLimits)
-
-	if tp.showUtil {
-		lineItems = append(lineItems, tl.memoryUtil)
+	if tp.showPendingPods() {
+		lineItems = append(lineItems, tl.age, tl.reason)
 	}
 
-	if tp.showPodCount {
-		lineItems = append(lineItems, tl.podCount)
+	return lineItems
+}
+
+// resourceItems returns the items of the resource columns of a line.
+func (tp *tablePrinter) resourceItems(tl *tableLine) []string {
+	var lineItems []string
+
+	for _, name := range tp.cm.resourceNames {
+		rl := tl.resources[name]
+		if rl == nil {
+			rl = &resourceLine{}
+		}
+
+		lineItems = append(lineItems, rl.requests)
+		lineItems = append(lineItems, rl.limits)
+
+		if tp.showOverhead {
+			lineItems = append(lineItems, rl.overhead)
+		}
+
+		if tp.showUtil {
+			lineItems = append(lineItems, rl.util)
+		}
 	}
 
 	return lineItems
 }
 
+// showPendingPods returns true if lines are printed for pending pods, which
+// need columns for how long they have been pending and why.
+func (tp *tablePrinter) showPendingPods() bool {
+	return tp.cm.pending != nil && !groupsPods(tp.groupBy) && (tp.showPods || tp.showContainers)
+}
+
+func (tp *tablePrinter) headerLine() *tableLine {
+	tl := &tableLine{
+		nodeGroup:     strings.ToUpper(tp.groupByNodeLabel),
+		node:          "NODE",
+		namespace:     "NAMESPACE",
+		pod:           "POD",
+		container:     "CONTAINER",
+		containerType: "TYPE",
+		workload:      "WORKLOAD",
+		replicas:      "REPLICAS",
+		resources:     map[string]*resourceLine{},
+		podCount:      "POD COUNT",
+		age:           "AGE",
+		reason:        "REASON",
+	}
+
+	for _, name := range tp.cm.resourceNames {
+		header := resourceHeader(name)
+		tl.resources[name] = &resourceLine{
+			requests: header + " REQUESTS",
+			limits:   header + " LIMITS",
+			overhead: header + " OVERHEAD",
+			util:     header + " UTIL",
+		}
+	}
+
+	return tl
+}
+
+// resourceHeader returns the column header prefix for a resource, e.g. "CPU"
+// or "NVIDIA.COM/GPU".
+func resourceHeader(resourceName string) string {
+	if resourceName == "ephemeral-storage" {
+		return "EPHEMERAL STORAGE"
+	}
+	return strings.ToUpper(resourceName)
+}
+
+// nodeGroupName returns the value of the label nodes are grouped by for the
+// given node.
+func (tp *tablePrinter) nodeGroupName(nodeName string) string {
+	if nodeName == pendingNodeName {
+		return "*"
+	}
+	if nm, ok := tp.cm.nodeMetrics[nodeName]; ok {
+		if value, ok := nm.labels[tp.groupByNodeLabel]; ok {
+			return value
+		}
+	}
+	return noNodeLabelValue
+}
+
+func (tp *tablePrinter) resourceLines(rms resourceMetrics) map[string]*resourceLine {
+	lines := map[string]*resourceLine{}
+	for name, rm := range rms {
+		lines[name] = &resourceLine{
+			requests: rm.requestString(tp.availableFormat),
+			limits:   rm.limitString(tp.availableFormat),
+			overhead: rm.overheadString(),
+			util:     rm.utilString(tp.availableFormat),
+		}
+	}
+	return lines
+}
+
 func (tp *tablePrinter) printClusterLine() {
 	tp.printLine(&tableLine{
-		node:           "*",
-		namespace:      "*",
-		pod:            "*",
-		container:      "*",
-		cpuRequests:    tp.cm.cpu.requestString(tp.availableFormat),
-		cpuLimits:      tp.cm.cpu.limitString(tp.availableFormat),
-		cpuUtil:        tp.cm.cpu.utilString(tp.availableFormat),
-		memoryRequests: tp.cm.memory.requestString(tp.availableFormat),
-		memoryLimits:   tp.cm.memory.limitString(tp.availableFormat),
-		memoryUtil:     tp.cm.memory.utilString(tp.availableFormat),
-		podCount:       tp.cm.podCount.podCountString(),
+		nodeGroup:     "*",
+		node:          "*",
+		namespace:     "*",
+		pod:           "*",
+		container:     "*",
+		containerType: "*",
+		workload:      "*",
+		replicas:      fmt.Sprintf("%d", tp.cm.podCount.current),
+		resources:     tp.resourceLines(tp.cm.resources),
+		podCount:      tp.cm.podCount.podCountString(),
+	})
+}
+
+func (tp *tablePrinter) printNodeGroupLine(ngm *nodeGroupMetric) {
+	tp.printLine(&tableLine{
+		nodeGroup:     ngm.name,
+		node:          "*",
+		namespace:     "*",
+		pod:           "*",
+		container:     "*",
+		containerType: "*",
+		resources:     tp.resourceLines(ngm.resources),
+		podCount:      ngm.podCount.podCountString(),
 	})
 }
 
 func (tp *tablePrinter) printNodeLine(nodeName string, nm *nodeMetric) {
 	tp.printLine(&tableLine{
-		node:           nodeName,
-		namespace:      "*",
-		pod:            "*",
-		container:      "*",
-		cpuRequests:    nm.cpu.requestString(tp.availableFormat),
-		cpuLimits:      nm.cpu.limitString(tp.availableFormat),
-		cpuUtil:        nm.cpu.utilString(tp.availableFormat),
-		memoryRequests: nm.memory.requestString(tp.availableFormat),
-		memoryLimits:   nm.memory.limitString(tp.availableFormat),
-		memoryUtil:     nm.memory.utilString(tp.availableFormat),
-		podCount:       nm.podCount.podCountString(),
+		nodeGroup:     tp.nodeGroupName(nodeName),
+		node:          nodeName,
+		namespace:     "*",
+		pod:           "*",
+		container:     "*",
+		containerType: "*",
+		resources:     tp.resourceLines(nm.resources),
+		podCount:      nm.podCount.podCountString(),
 	})
 }
 
-func (tp *tablePrinter) printPodLine(nodeName string, pm *podMetric) {
+func (tp *tablePrinter) printGroupLine(gm *groupMetric) {
 	tp.printLine(&tableLine{
-		node:           nodeName,
-		namespace:      pm.namespace,
-		pod:            pm.name,
-		container:      "*",
-		cpuRequests:    pm.cpu.requestString(tp.availableFormat),
-		cpuLimits:      pm.cpu.limitString(tp.availableFormat),
-		cpuUtil:        pm.cpu.utilString(tp.availableFormat),
-		memoryRequests: pm.memory.requestString(tp.availableFormat),
-		memoryLimits:   pm.memory.limitString(tp.availableFormat),
-		memoryUtil:     pm.memory.utilString(tp.availableFormat),
+		node:          "*",
+		namespace:     gm.namespace,
+		pod:           "*",
+		container:     "*",
+		containerType: "*",
+		workload:      gm.workloadString(),
+		replicas:      fmt.Sprintf("%d", gm.podCount.current),
+		resources:     tp.resourceLines(gm.resources),
+		podCount:      gm.podCount.podCountString(),
 	})
 }
 
+func (tp *tablePrinter) printPodLine(nodeName string, pm *podMetric) {
+	tl := &tableLine{
+		nodeGroup:     tp.nodeGroupName(nodeName),
+		node:          nodeName,
+		namespace:     pm.namespace,
+		pod:           pm.name,
+		container:     "*",
+		containerType: "*",
+		workload:      pm.getWorkload().String(),
+		resources:     tp.resourceLines(pm.resources),
+	}
+	if nodeName == pendingNodeName {
+		tl.age = duration.HumanDuration(time.Since(pm.created))
+		tl.reason = pm.schedulingReason
+	}
+	tp.printLine(tl)
+}
+
 func (tp *tablePrinter) printContainerLine(nodeName string, pm *podMetric, cm *containerMetric) {
 	tp.printLine(&tableLine{
-		node:           nodeName,
-		namespace:      pm.namespace,
-		pod:            pm.name,
-		container:      cm.name,
-		cpuRequests:    cm.cpu.requestString(tp.availableFormat),
-		cpuLimits:      cm.cpu.limitString(tp.availableFormat),
-		cpuUtil:        cm.cpu.utilString(tp.availableFormat),
-		memoryRequests: cm.memory.requestString(tp.availableFormat),
-		memoryLimits:   cm.memory.limitString(tp.availableFormat),
-		memoryUtil:     cm.memory.utilString(tp.availableFormat),
+		nodeGroup:     tp.nodeGroupName(nodeName),
+		node:          nodeName,
+		namespace:     pm.namespace,
+		pod:           pm.name,
+		container:     cm.name,
+		containerType: cm.containerType,
+		workload:      pm.getWorkload().String(),
+		resources:     tp.resourceLines(cm.resources),
 	})
 }
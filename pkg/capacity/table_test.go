@@ -15,13 +15,22 @@
 package capacity
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
 
+	apiv1 "github.com/robscott/kube-capacity/pkg/api/v1"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestGetLineItems(t *testing.T) {
+	cm := &clusterMetric{resourceNames: DefaultResources}
+
 	tpNone := &tablePrinter{
+		cm:             cm,
 		showPods:       false,
 		showUtil:       false,
 		showPodCount:   false,
@@ -30,6 +39,7 @@ func TestGetLineItems(t *testing.T) {
 	}
 
 	tpSome := &tablePrinter{
+		cm:             cm,
 		showPods:       false,
 		showUtil:       false,
 		showPodCount:   false,
@@ -38,6 +48,7 @@ func TestGetLineItems(t *testing.T) {
 	}
 
 	tpAll := &tablePrinter{
+		cm:             cm,
 		showPods:       true,
 		showUtil:       true,
 		showContainers: true,
@@ -45,18 +56,37 @@ func TestGetLineItems(t *testing.T) {
 		showPodCount:   true,
 	}
 
+	tpNamespace := &tablePrinter{
+		cm:       cm,
+		showPods: true,
+		groupBy:  NamespaceGrouping,
+	}
+
+	tpNodeGroup := &tablePrinter{
+		cm:               cm,
+		groupByNodeLabel: "topology.kubernetes.io/zone",
+	}
+
 	tl := &tableLine{
-		node:           "example-node-1",
-		namespace:      "example-namespace",
-		pod:            "nginx-fsde",
-		container:      "nginx",
-		cpuRequests:    "100m",
-		cpuLimits:      "200m",
-		cpuUtil:        "14m",
-		memoryRequests: "1000Mi",
-		memoryLimits:   "2000Mi",
-		memoryUtil:     "326Mi",
-		podCount:       "1/110",
+		nodeGroup:     "zone-a",
+		node:          "example-node-1",
+		namespace:     "example-namespace",
+		pod:           "nginx-fsde",
+		container:     "nginx",
+		containerType: "app",
+		resources: map[string]*resourceLine{
+			"cpu": {
+				requests: "100m",
+				limits:   "200m",
+				util:     "14m",
+			},
+			"memory": {
+				requests: "1000Mi",
+				limits:   "2000Mi",
+				util:     "326Mi",
+			},
+		},
+		podCount: "1/110",
 	}
 
 	var testCases = []struct {
@@ -85,6 +115,7 @@ func TestGetLineItems(t *testing.T) {
 				"example-namespace",
 				"nginx-fsde",
 				"nginx",
+				"app",
 				"100m",
 				"200m",
 				"1000Mi",
@@ -99,6 +130,7 @@ func TestGetLineItems(t *testing.T) {
 				"example-namespace",
 				"nginx-fsde",
 				"nginx",
+				"app",
 				"100m",
 				"200m",
 				"14m",
@@ -107,6 +139,30 @@ func TestGetLineItems(t *testing.T) {
 				"326Mi",
 				"1/110",
 			},
+		}, {
+			name: "group by node label",
+			tp:   tpNodeGroup,
+			tl:   tl,
+			expected: []string{
+				"zone-a",
+				"example-node-1",
+				"100m",
+				"200m",
+				"1000Mi",
+				"2000Mi",
+			},
+		}, {
+			name: "group by namespace",
+			tp:   tpNamespace,
+			tl:   tl,
+			expected: []string{
+				"example-namespace",
+				"nginx-fsde",
+				"100m",
+				"200m",
+				"1000Mi",
+				"2000Mi",
+			},
 		},
 	}
 
@@ -117,3 +173,76 @@ func TestGetLineItems(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintPending(t *testing.T) {
+	nodeList := &corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	queued := pendingTestPod("default", "queued", "300m", time.Now().Add(-5*time.Minute))
+
+	cm := newClusterMetric(nodeList, nil, DefaultResources)
+	cm.addPending()
+	cm.addPod(&web, nil)
+	cm.addPod(&queued, nil)
+	cm.addNodeMetrics(true)
+	cc := &ClusterCapacity{cm: cm}
+
+	tp := &tablePrinter{cm: &cc.cm, sortBy: "name", showPods: true, showNamespace: true}
+	assert.Equal(t, [][]string{
+		{"NODE", "NAMESPACE", "POD", "CPU REQUESTS", "CPU LIMITS", "MEMORY REQUESTS", "MEMORY LIMITS", "AGE", "REASON"},
+		{"example-node-1", "*", "*", "200m (20%)", "400m (40%)", "0Mi (0%)", "0Mi (0%)", "", ""},
+		{"example-node-1", "default", "web", "200m (20%)", "400m (40%)", "0Mi (0%)", "0Mi (0%)", "", ""},
+		{"<pending>", "*", "*", "300m (30%)", "300m (30%)", "0Mi (0%)", "0Mi (0%)", "", ""},
+		{"<pending>", "default", "queued", "300m (30%)", "300m (30%)", "0Mi (0%)", "0Mi (0%)", "5m", "Unschedulable"},
+	}, tp.getLines())
+
+	var out bytes.Buffer
+	printer, err := NewPrinter(PrintOptions{Output: JSONOutput})
+	assert.NoError(t, err)
+	assert.NoError(t, printer.Print(&out, cc))
+
+	var lcm apiv1.ClusterMetrics
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &lcm))
+	assert.Nil(t, lcm.Nodes[0].Pods)
+	assert.Equal(t, "300m", lcm.Pending.CPU.Requests)
+	assert.Equal(t, "30%", lcm.Pending.CPU.RequestsPct)
+	assert.Equal(t, "queued", lcm.Pending.Pods[0].Name)
+	assert.Equal(t, "5m", lcm.Pending.Pods[0].Age)
+	assert.Equal(t, "Unschedulable", lcm.Pending.Pods[0].Reason)
+}
+
+func TestPrintOverhead(t *testing.T) {
+	nodeList := &corev1.NodeList{Items: []corev1.Node{groupTestNode("example-node-1")}}
+	web := groupTestPod("example-node-1", "default", "web", "200m", "400m")
+	sandboxed := groupTestPod("example-node-1", "default", "sandboxed", "100m", "100m")
+	runtimeClass := "kata"
+	sandboxed.Spec.RuntimeClassName = &runtimeClass
+	sandboxed.Spec.Overhead = corev1.ResourceList{"cpu": resource.MustParse("250m")}
+
+	cm := buildClusterMetric(&corev1.PodList{Items: []corev1.Pod{web, sandboxed}}, nil, nodeList, nil, DefaultResources)
+	cc := &ClusterCapacity{cm: cm}
+
+	tp := &tablePrinter{cm: &cc.cm, sortBy: "name", showOverhead: true}
+	assert.Equal(t, [][]string{
+		{"NODE", "CPU REQUESTS", "CPU LIMITS", "CPU OVERHEAD", "MEMORY REQUESTS", "MEMORY LIMITS", "MEMORY OVERHEAD"},
+		{"example-node-1", "550m (55%)", "750m (75%)", "250m (25%)", "0Mi (0%)", "0Mi (0%)", "0Mi (0%)"},
+	}, tp.getLines())
+
+	var out bytes.Buffer
+	assert.NoError(t, tp.printRuntimeClasses(&out))
+	assert.Contains(t, out.String(), "RUNTIME CLASS")
+	assert.Regexp(t, `kata\s+1\s+350m \(35%\)`, out.String())
+
+	out.Reset()
+	printer, err := NewPrinter(PrintOptions{Output: JSONOutput, ShowOverhead: true})
+	assert.NoError(t, err)
+	assert.NoError(t, printer.Print(&out, cc))
+
+	var lcm apiv1.ClusterMetrics
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &lcm))
+	assert.Equal(t, "250m", lcm.Nodes[0].CPU.Overhead)
+	assert.Equal(t, "25%", lcm.Nodes[0].CPU.OverheadPct)
+	assert.Len(t, lcm.ClusterTotals.RuntimeClasses, 1)
+	assert.Equal(t, "kata", lcm.ClusterTotals.RuntimeClasses[0].Name)
+	assert.Equal(t, int64(1), lcm.ClusterTotals.RuntimeClasses[0].Pods)
+	assert.Equal(t, "250m", lcm.ClusterTotals.RuntimeClasses[0].CPU.Overhead)
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	//GoTemplateOutput is the prefix of go-template=<template> output types
+	GoTemplateOutput string = "go-template"
+	//GoTemplateFileOutput is the prefix of go-template-file=<file> output types
+	GoTemplateFileOutput string = "go-template-file"
+	//JSONPathOutput is the prefix of jsonpath=<template> output types
+	JSONPathOutput string = "jsonpath"
+)
+
+// TemplateOutputs returns the output types that take a template argument, as
+// in --output jsonpath={.clusterTotals.cpu.requests}
+func TemplateOutputs() []string {
+	return []string{
+		GoTemplateOutput,
+		GoTemplateFileOutput,
+		JSONPathOutput,
+		CustomColumnsOutput,
+		CustomColumnsFileOutput,
+	}
+}
+
+// ParseTemplateOutput splits a template output type into its format and
+// argument. It returns false if the output type does not take a template.
+func ParseTemplateOutput(output string) (format, arg string, ok bool) {
+	format, arg, found := strings.Cut(output, "=")
+	if !found {
+		return "", "", false
+	}
+
+	for _, f := range TemplateOutputs() {
+		if f == format {
+			return format, arg, true
+		}
+	}
+	return "", "", false
+}
+
+// templatePrinter executes a Go template or JSONPath expression against the
+// same structure JSON output is built from. Like kubectl, the data is
+// converted to JSON first, so fields are referred to by their JSON names.
+type templatePrinter struct {
+	lp     *listPrinter
+	format string
+	arg    string
+}
+
+func (tp *templatePrinter) Print(w io.Writer) error {
+	execute, err := tp.parse()
+	if err != nil {
+		return err
+	}
+
+	jsonRaw, err := json.Marshal(tp.lp.buildListOutput())
+	if err != nil {
+		return err
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(jsonRaw, &data); err != nil {
+		return err
+	}
+
+	return execute(w, data)
+}
+
+func (tp *templatePrinter) parse() (func(io.Writer, interface{}) error, error) {
+	switch tp.format {
+	case GoTemplateOutput, GoTemplateFileOutput:
+		text := tp.arg
+		if tp.format == GoTemplateFileOutput {
+			raw, err := os.ReadFile(tp.arg)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading template file: %v", err)
+			}
+			text = string(raw)
+		}
+
+		t, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing template: %v", err)
+		}
+		return t.Execute, nil
+	case JSONPathOutput:
+		jp := jsonpath.New("output")
+		if err := jp.Parse(relaxedJSONPath(tp.arg)); err != nil {
+			return nil, fmt.Errorf("Error parsing jsonpath: %v", err)
+		}
+		return jp.Execute, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported template output: %s", tp.format)
+}
+
+// relaxedJSONPath wraps expressions like .clusterTotals.cpu in braces, as
+// kubectl does.
+func relaxedJSONPath(expression string) string {
+	if strings.Contains(expression, "{") {
+		return expression
+	}
+	return "{" + expression + "}"
+}
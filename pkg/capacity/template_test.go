@@ -0,0 +1,94 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplateOutput(t *testing.T) {
+	format, arg, ok := ParseTemplateOutput("jsonpath={.nodes[*].name}")
+	assert.True(t, ok)
+	assert.Equal(t, JSONPathOutput, format)
+	assert.Equal(t, "{.nodes[*].name}", arg)
+
+	format, arg, ok = ParseTemplateOutput("go-template={{ .clusterTotals.cpu.requests }}")
+	assert.True(t, ok)
+	assert.Equal(t, GoTemplateOutput, format)
+	assert.Equal(t, "{{ .clusterTotals.cpu.requests }}", arg)
+
+	_, _, ok = ParseTemplateOutput("json")
+	assert.False(t, ok)
+
+	_, _, ok = ParseTemplateOutput("xml=foo")
+	assert.False(t, ok)
+}
+
+func TestTemplatePrinter(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+	lp := &listPrinter{cm: &cm, showPods: true, sortBy: "name"}
+
+	templateFile := filepath.Join(t.TempDir(), "nodes.tmpl")
+	assert.NoError(t, os.WriteFile(templateFile,
+		[]byte("{{ range .nodes }}{{ .name }} {{ .cpu.requests }}\n{{ end }}"), 0600))
+
+	var testCases = []struct {
+		format   string
+		arg      string
+		expected string
+	}{
+		{
+			format:   JSONPathOutput,
+			arg:      "{.clusterTotals.cpu.requests}",
+			expected: "900m",
+		}, {
+			format:   JSONPathOutput,
+			arg:      ".nodes[*].name",
+			expected: "example-node-1 example-node-2",
+		}, {
+			format:   JSONPathOutput,
+			arg:      `{range .nodes[0].pods[*]}{.namespace}/{.name}{"\n"}{end}`,
+			expected: "kube-system/dns\ndefault/web\n",
+		}, {
+			format:   GoTemplateOutput,
+			arg:      "{{ len .nodes }} nodes, {{ .clusterTotals.cpu.limitsPercent }} cpu limits",
+			expected: "2 nodes, 65% cpu limits",
+		}, {
+			format:   GoTemplateFileOutput,
+			arg:      templateFile,
+			expected: "example-node-1 500m\nexample-node-2 400m\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format+"="+tc.arg, func(t *testing.T) {
+			var buf bytes.Buffer
+			tp := &templatePrinter{lp: lp, format: tc.format, arg: tc.arg}
+			assert.NoError(t, tp.Print(&buf))
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+
+	tp := &templatePrinter{lp: lp, format: GoTemplateOutput, arg: "{{ .nodes"}
+	assert.Error(t, tp.Print(&bytes.Buffer{}))
+
+	tp = &templatePrinter{lp: lp, format: GoTemplateFileOutput, arg: filepath.Join(t.TempDir(), "missing")}
+	assert.Error(t, tp.Print(&bytes.Buffer{}))
+}
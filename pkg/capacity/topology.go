@@ -0,0 +1,309 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// podAffinityTerm is a required pod affinity or anti-affinity term with its
+// label selector parsed. A nil namespaces list selects pods in every
+// namespace, which is how namespace selectors are treated as namespace labels
+// are not collected.
+type podAffinityTerm struct {
+	topologyKey string
+	namespaces  []string
+	selector    labels.Selector
+}
+
+// topologySpread is a topology spread constraint that must be satisfied,
+// with its label selector parsed and matchLabelKeys applied.
+type topologySpread struct {
+	topologyKey   string
+	maxSkew       int64
+	minDomains    int64
+	selector      labels.Selector
+	honorAffinity bool
+	honorTaints   bool
+}
+
+// topologyCounts holds how many pods matching each inter-pod constraint of a
+// shape are in each topology domain, so nodes can be checked against them
+// without going through every pod again. existingAntiAffinity holds the
+// domains, by topology key, of pods whose anti-affinity matches the shape.
+type topologyCounts struct {
+	shape                *podShape
+	affinity             []map[string]int64
+	antiAffinity         []map[string]int64
+	spread               []map[string]int64
+	existingAntiAffinity map[string]map[string]bool
+}
+
+func newPodAffinityTerms(terms []corev1.PodAffinityTerm, namespace string) []*podAffinityTerm {
+	out := []*podAffinityTerm{}
+	for _, term := range terms {
+		pat := &podAffinityTerm{
+			topologyKey: term.TopologyKey,
+			selector:    parseLabelSelector(term.LabelSelector),
+		}
+		if term.NamespaceSelector == nil {
+			pat.namespaces = term.Namespaces
+			if len(pat.namespaces) == 0 {
+				pat.namespaces = []string{namespace}
+			}
+		}
+		out = append(out, pat)
+	}
+	return out
+}
+
+// newTopologySpreads returns the constraints that must be satisfied. Those
+// with whenUnsatisfiable set to ScheduleAnyway only affect scoring and are
+// left out.
+func newTopologySpreads(constraints []corev1.TopologySpreadConstraint, podLabels map[string]string) []*topologySpread {
+	out := []*topologySpread{}
+	for _, c := range constraints {
+		if c.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+
+		ts := &topologySpread{
+			topologyKey:   c.TopologyKey,
+			maxSkew:       int64(c.MaxSkew),
+			selector:      parseLabelSelector(c.LabelSelector),
+			honorAffinity: c.NodeAffinityPolicy == nil || *c.NodeAffinityPolicy == corev1.NodeInclusionPolicyHonor,
+			honorTaints:   c.NodeTaintsPolicy != nil && *c.NodeTaintsPolicy == corev1.NodeInclusionPolicyHonor,
+		}
+		if c.MinDomains != nil {
+			ts.minDomains = int64(*c.MinDomains)
+		}
+
+		for _, key := range c.MatchLabelKeys {
+			if value, ok := podLabels[key]; ok {
+				if r, err := labels.NewRequirement(key, selection.Equals, []string{value}); err == nil {
+					ts.selector = ts.selector.Add(*r)
+				}
+			}
+		}
+
+		out = append(out, ts)
+	}
+	return out
+}
+
+// parseLabelSelector returns the selector for a label selector. Like the
+// scheduler, a missing or invalid selector matches nothing.
+func parseLabelSelector(ls *metav1.LabelSelector) labels.Selector {
+	if ls == nil {
+		return labels.Nothing()
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ls)
+	if err != nil {
+		return labels.Nothing()
+	}
+	return selector
+}
+
+func (pat *podAffinityTerm) matches(namespace string, podLabels map[string]string) bool {
+	if pat.namespaces != nil && !containsResource(pat.namespaces, namespace) {
+		return false
+	}
+	return pat.selector.Matches(labels.Set(podLabels))
+}
+
+// topologyValue returns the topology domain of a node for a key. Nodes are
+// expected to have a hostname label, but the node name stands in for it.
+func topologyValue(nm *nodeMetric, key string) (string, bool) {
+	if value, ok := nm.labels[key]; ok {
+		return value, true
+	}
+	if key == corev1.LabelHostname {
+		return nm.name, true
+	}
+	return "", false
+}
+
+// countPods returns how many pods on the node match.
+func countPods(nm *nodeMetric, matches func(pm *podMetric) bool) int64 {
+	var count int64
+	for _, pm := range nm.podMetrics {
+		if matches(pm) {
+			count++
+		}
+	}
+	return count
+}
+
+// newTopologyCounts counts the pods matching each inter-pod constraint of
+// the shape in each topology domain, and finds the domains where pods
+// already running have anti-affinity to the shape.
+func newTopologyCounts(shape *podShape, nodeMetrics []*nodeMetric) *topologyCounts {
+	tc := &topologyCounts{shape: shape, existingAntiAffinity: map[string]map[string]bool{}}
+
+	for _, nm := range nodeMetrics {
+		if nm.antiAffinityPods == 0 {
+			continue
+		}
+		for _, pm := range nm.podMetrics {
+			for _, term := range pm.antiAffinity {
+				value, ok := topologyValue(nm, term.topologyKey)
+				if !ok || !term.matches(shape.namespace, shape.labels) {
+					continue
+				}
+				if tc.existingAntiAffinity[term.topologyKey] == nil {
+					tc.existingAntiAffinity[term.topologyKey] = map[string]bool{}
+				}
+				tc.existingAntiAffinity[term.topologyKey][value] = true
+			}
+		}
+	}
+
+	termCounts := func(term *podAffinityTerm) map[string]int64 {
+		counts := map[string]int64{}
+		for _, nm := range nodeMetrics {
+			if value, ok := topologyValue(nm, term.topologyKey); ok {
+				counts[value] += countPods(nm, func(pm *podMetric) bool {
+					return term.matches(pm.namespace, pm.labels)
+				})
+			}
+		}
+		return counts
+	}
+	for _, term := range shape.podAffinity {
+		tc.affinity = append(tc.affinity, termCounts(term))
+	}
+	for _, term := range shape.podAntiAffinity {
+		tc.antiAffinity = append(tc.antiAffinity, termCounts(term))
+	}
+
+	for _, ts := range shape.topologySpread {
+		counts := map[string]int64{}
+		for _, nm := range nodeMetrics {
+			value, ok := topologyValue(nm, ts.topologyKey)
+			if !ok || !ts.eligible(shape, nm) {
+				continue
+			}
+			counts[value] += countPods(nm, func(pm *podMetric) bool {
+				return ts.matches(shape, pm.namespace, pm.labels)
+			})
+		}
+		tc.spread = append(tc.spread, counts)
+	}
+
+	return tc
+}
+
+// eligible returns true if pods on the node count towards the spread, which
+// by default is the case for nodes matching the node selector and affinity
+// of the shape regardless of taints.
+func (ts *topologySpread) eligible(shape *podShape, nm *nodeMetric) bool {
+	if ts.honorAffinity && shape.nodeAffinityReason(nm) != "" {
+		return false
+	}
+	if ts.honorTaints {
+		for i := range nm.taints {
+			taint := &nm.taints[i]
+			if taint.Effect != corev1.TaintEffectPreferNoSchedule && !shape.tolerates(taint) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches returns true if a pod counts towards the spread, which only
+// includes pods in the same namespace as the shape.
+func (ts *topologySpread) matches(shape *podShape, namespace string, podLabels map[string]string) bool {
+	return namespace == shape.namespace && ts.selector.Matches(labels.Set(podLabels))
+}
+
+// reason returns why a pod of the shape cannot be placed on the node because
+// of the pods already in its topology domains, or an empty string if it can.
+func (tc *topologyCounts) reason(nm *nodeMetric) string {
+	shape := tc.shape
+
+	for i, term := range shape.podAntiAffinity {
+		if value, ok := topologyValue(nm, term.topologyKey); ok && tc.antiAffinity[i][value] > 0 {
+			return "pod anti-affinity does not match"
+		}
+	}
+
+	for key, domains := range tc.existingAntiAffinity {
+		if value, ok := topologyValue(nm, key); ok && domains[value] {
+			return "existing pod anti-affinity does not match"
+		}
+	}
+
+	for i, term := range shape.podAffinity {
+		value, ok := topologyValue(nm, term.topologyKey)
+		if !ok {
+			return "pod affinity does not match"
+		}
+		if tc.affinity[i][value] > 0 {
+			continue
+		}
+		// Like the scheduler, the first of a group of pods with affinity to
+		// each other can go anywhere.
+		if sumCounts(tc.affinity[i]) == 0 && term.matches(shape.namespace, shape.labels) {
+			continue
+		}
+		return "pod affinity does not match"
+	}
+
+	for i, ts := range shape.topologySpread {
+		value, ok := topologyValue(nm, ts.topologyKey)
+		if !ok {
+			return "topology spread constraints do not match"
+		}
+
+		count := tc.spread[i][value]
+		if ts.matches(shape, shape.namespace, shape.labels) {
+			count++
+		}
+		if count-minCount(tc.spread[i], ts.minDomains) > ts.maxSkew {
+			return "topology spread constraints do not match"
+		}
+	}
+
+	return ""
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var sum int64
+	for _, count := range counts {
+		sum += count
+	}
+	return sum
+}
+
+// minCount returns the lowest count of any domain, which is zero when there
+// are fewer domains than minDomains.
+func minCount(counts map[string]int64, minDomains int64) int64 {
+	if int64(len(counts)) < minDomains {
+		return 0
+	}
+
+	first := true
+	var min int64
+	for _, count := range counts {
+		if first || count < min {
+			min, first = count, false
+		}
+	}
+	return min
+}
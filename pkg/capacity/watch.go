@@ -0,0 +1,129 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	clearScreen = "\033[H\033[2J"
+
+	// Changed and unchanged cells are wrapped in escape codes of the same
+	// length so that tabwriter keeps the columns aligned.
+	changedColor   = "\033[33m"
+	unchangedColor = "\033[39m"
+	resetColor     = "\033[0m"
+)
+
+// tableDiff highlights the cells of a table that changed since the previous
+// time it was printed. Lines are matched by the node, namespace, pod and
+// container they describe.
+type tableDiff struct {
+	previous map[string][]string
+	current  map[string][]string
+}
+
+// highlight records the items of a line and returns them wrapped in escape
+// codes, highlighting any that changed.
+func (td *tableDiff) highlight(key string, lineItems []string) []string {
+	if td.current == nil {
+		td.current = map[string][]string{}
+	}
+	td.current[key] = lineItems
+
+	previousItems, seen := td.previous[key]
+
+	highlighted := make([]string, len(lineItems))
+	for i, item := range lineItems {
+		color := unchangedColor
+		if td.previous != nil && (!seen || i >= len(previousItems) || previousItems[i] != item) {
+			color = changedColor
+		}
+		highlighted[i] = color + item + resetColor
+	}
+
+	return highlighted
+}
+
+// next starts a new iteration, comparing against the lines recorded since the
+// last call.
+func (td *tableDiff) next() {
+	td.previous = td.current
+	td.current = nil
+}
+
+func (tl *tableLine) key() string {
+	return strings.Join([]string{tl.nodeGroup, tl.node, tl.namespace, tl.workload, tl.pod, tl.container}, "/")
+}
+
+// watchTable collects and prints the table every interval until the context
+// is cancelled. Errors collecting are written to errOut and collecting is
+// tried again on the next tick. The screen is only cleared and changes only
+// highlighted when out is a terminal.
+func watchTable(ctx context.Context, out, errOut io.Writer, collect func() (*ClusterCapacity, error), interval time.Duration,
+	op *outputPrinter) error {
+	diff := &tableDiff{}
+	terminal := isTerminal(out)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cc, err := collect()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(errOut, "Error collecting capacity, retrying in %s: %v\n", interval, err)
+		} else {
+			tp := op.tablePrinter(cc)
+			if terminal {
+				tp.diff = diff
+				fmt.Fprint(out, clearScreen)
+			}
+
+			fmt.Fprintf(out, "Every %s: kube-capacity\t%s\n\n", interval, time.Now().Format(time.RFC1123))
+			if err := tp.Print(out); err != nil {
+				return err
+			}
+			if !terminal {
+				fmt.Fprintln(out)
+			}
+			diff.next()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// isTerminal returns true if w is a terminal rather than e.g. a file or pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
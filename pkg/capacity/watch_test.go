@@ -0,0 +1,110 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableDiffHighlight(t *testing.T) {
+	td := &tableDiff{}
+
+	node1 := &tableLine{node: "example-node-1"}
+	node2 := &tableLine{node: "example-node-2"}
+
+	assert.Equal(t, []string{
+		unchangedColor + "example-node-1" + resetColor,
+		unchangedColor + "650m (65%%)" + resetColor,
+	}, td.highlight(node1.key(), []string{"example-node-1", "650m (65%%)"}))
+	td.next()
+
+	assert.Equal(t, []string{
+		unchangedColor + "example-node-1" + resetColor,
+		changedColor + "850m (85%%)" + resetColor,
+	}, td.highlight(node1.key(), []string{"example-node-1", "850m (85%%)"}))
+	assert.Equal(t, []string{
+		changedColor + "example-node-2" + resetColor,
+		changedColor + "100m (10%%)" + resetColor,
+	}, td.highlight(node2.key(), []string{"example-node-2", "100m (10%%)"}))
+	td.next()
+
+	assert.Equal(t, []string{
+		unchangedColor + "example-node-1" + resetColor,
+		unchangedColor + "850m (85%%)" + resetColor,
+	}, td.highlight(node1.key(), []string{"example-node-1", "850m (85%%)"}))
+}
+
+func TestTableLineKey(t *testing.T) {
+	pod := &tableLine{node: "example-node-1", namespace: "default", pod: "web"}
+	container := &tableLine{node: "example-node-1", namespace: "default", pod: "web", container: "nginx"}
+
+	assert.NotEqual(t, pod.key(), container.key())
+	assert.Equal(t, pod.key(), (&tableLine{node: "example-node-1", namespace: "default", pod: "web"}).key())
+}
+
+func TestWatchTableStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	op, err := newOutputPrinter(PrintOptions{})
+	assert.NoError(t, err)
+
+	collected := 0
+	collect := func() (*ClusterCapacity, error) {
+		collected++
+		return &ClusterCapacity{cm: getTestGroupClusterMetric()}, nil
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, watchTable(ctx, &buf, &buf, collect, time.Hour, op))
+	assert.Equal(t, 1, collected)
+	assert.Contains(t, buf.String(), "example-node-1")
+}
+
+func TestWatchTableRetriesAfterErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	op, err := newOutputPrinter(PrintOptions{})
+	assert.NoError(t, err)
+
+	collected := 0
+	collect := func() (*ClusterCapacity, error) {
+		collected++
+		switch collected {
+		case 1:
+			return nil, errors.New("timeout")
+		case 3:
+			cancel()
+		}
+		return &ClusterCapacity{cm: getTestGroupClusterMetric()}, nil
+	}
+
+	var out, errOut bytes.Buffer
+	assert.NoError(t, watchTable(ctx, &out, &errOut, collect, time.Millisecond, op))
+	assert.Equal(t, 3, collected)
+	assert.Equal(t, "Error collecting capacity, retrying in 1ms: timeout\n", errOut.String())
+
+	// Output that is not a terminal has no escape codes.
+	assert.Equal(t, 2, strings.Count(out.String(), "Every 1ms: kube-capacity"))
+	assert.NotContains(t, out.String(), "\033")
+}
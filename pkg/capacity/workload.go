@@ -0,0 +1,128 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workloadRef identifies the top level controller owning a pod, e.g. the
+// Deployment behind a ReplicaSet. Pods without a controller are their own
+// workload.
+type workloadRef struct {
+	kind string
+	name string
+}
+
+func (wr workloadRef) String() string {
+	return fmt.Sprintf("%s/%s", wr.kind, wr.name)
+}
+
+// getPodWorkloads resolves the workload owning each pod in the cluster
+// metric, keyed by "namespace-name". ReplicaSets are followed to their
+// Deployments and Jobs to their CronJobs, which are listed in chunks like
+// pods. If those owners cannot be listed, pods are attributed to the
+// ReplicaSet or Job directly and the errors are returned as warnings.
+func getPodWorkloads(ctx context.Context, clientset kubernetes.Interface, cm *clusterMetric,
+	namespace string, chunkSize int64) (map[string]workloadRef, []error) {
+	var needReplicaSets, needJobs bool
+	for _, nm := range cm.nodeMetrics {
+		for _, pm := range nm.podMetrics {
+			if ref := pm.controller; ref != nil {
+				needReplicaSets = needReplicaSets || ref.Kind == "ReplicaSet"
+				needJobs = needJobs || ref.Kind == "Job"
+			}
+		}
+	}
+
+	owners := map[string]*metav1.OwnerReference{}
+	warnings := []error{}
+
+	if needReplicaSets {
+		err := eachListItem(ctx, chunkSize, metav1.ListOptions{},
+			func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return clientset.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+			},
+			func(obj runtime.Object) error {
+				rs := obj.(*appsv1.ReplicaSet)
+				owners[fmt.Sprintf("ReplicaSet/%s-%s", rs.Namespace, rs.Name)] = metav1.GetControllerOf(rs)
+				return nil
+			})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("Error listing ReplicaSets, showing them instead of their owners: %v", err))
+		}
+	}
+
+	if needJobs {
+		err := eachListItem(ctx, chunkSize, metav1.ListOptions{},
+			func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+			},
+			func(obj runtime.Object) error {
+				job := obj.(*batchv1.Job)
+				owners[fmt.Sprintf("Job/%s-%s", job.Namespace, job.Name)] = metav1.GetControllerOf(job)
+				return nil
+			})
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("Error listing Jobs, showing them instead of their owners: %v", err))
+		}
+	}
+
+	workloads := map[string]workloadRef{}
+	for _, nm := range cm.nodeMetrics {
+		for key, pm := range nm.podMetrics {
+			ref := pm.controller
+			if ref == nil {
+				workloads[key] = workloadRef{kind: "Pod", name: pm.name}
+				continue
+			}
+
+			wr := workloadRef{kind: ref.Kind, name: ref.Name}
+			if owner := owners[fmt.Sprintf("%s/%s-%s", ref.Kind, pm.namespace, ref.Name)]; owner != nil {
+				wr = workloadRef{kind: owner.Kind, name: owner.Name}
+			}
+			workloads[key] = wr
+		}
+	}
+
+	return workloads, warnings
+}
+
+// addWorkloads records the workload owning each pod in the cluster metric.
+func (cm *clusterMetric) addWorkloads(workloads map[string]workloadRef) {
+	for _, nm := range cm.nodeMetrics {
+		for key, pm := range nm.podMetrics {
+			if wr, ok := workloads[key]; ok {
+				pm.workload = wr
+			}
+		}
+	}
+}
+
+// getWorkload returns the workload owning the pod, falling back to the pod
+// itself when none was resolved.
+func (pm *podMetric) getWorkload() workloadRef {
+	if pm.workload.kind == "" {
+		return workloadRef{kind: "Pod", name: pm.name}
+	}
+	return pm.workload
+}
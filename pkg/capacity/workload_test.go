@@ -0,0 +1,143 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capacity
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetPodWorkloads(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "api-7b5bcb98f8",
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{controllerRef("Deployment", "api")},
+			},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "bare",
+				Namespace: "default",
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "backup-27812340",
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{controllerRef("CronJob", "backup")},
+			},
+		},
+	)
+
+	podList := &corev1.PodList{
+		Items: []corev1.Pod{
+			*ownedPod("api-7b5bcb98f8-x2kq", controllerRef("ReplicaSet", "api-7b5bcb98f8")),
+			*ownedPod("api-7b5bcb98f8-9fjw", controllerRef("ReplicaSet", "api-7b5bcb98f8")),
+			*ownedPod("bare-l2k4", controllerRef("ReplicaSet", "bare")),
+			*ownedPod("backup-27812340-qx8z", controllerRef("Job", "backup-27812340")),
+			*ownedPod("db-0", controllerRef("StatefulSet", "db")),
+			*ownedPod("debug"),
+		},
+	}
+
+	cm := buildClusterMetric(podList, nil, &corev1.NodeList{Items: []corev1.Node{*node("mynode", nil)}}, nil, DefaultResources)
+	workloads, warnings := getPodWorkloads(context.TODO(), clientset, &cm, "", 2)
+	assert.Empty(t, warnings)
+
+	assert.Equal(t, map[string]workloadRef{
+		"default-api-7b5bcb98f8-x2kq":  {kind: "Deployment", name: "api"},
+		"default-api-7b5bcb98f8-9fjw":  {kind: "Deployment", name: "api"},
+		"default-bare-l2k4":            {kind: "ReplicaSet", name: "bare"},
+		"default-backup-27812340-qx8z": {kind: "CronJob", name: "backup"},
+		"default-db-0":                 {kind: "StatefulSet", name: "db"},
+		"default-debug":                {kind: "Pod", name: "debug"},
+	}, workloads)
+}
+
+func TestGetPodWorkloadsListError(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	podList := &corev1.PodList{
+		Items: []corev1.Pod{*ownedPod("api-7b5bcb98f8-x2kq", controllerRef("ReplicaSet", "api-7b5bcb98f8"))},
+	}
+
+	cm := buildClusterMetric(podList, nil, &corev1.NodeList{Items: []corev1.Node{*node("mynode", nil)}}, nil, DefaultResources)
+	workloads, warnings := getPodWorkloads(context.TODO(), clientset, &cm, "", 2)
+
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].Error(), "Error listing ReplicaSets")
+	assert.Equal(t, workloadRef{kind: "ReplicaSet", name: "api-7b5bcb98f8"}, workloads["default-api-7b5bcb98f8-x2kq"])
+}
+
+func TestGetSortedGroupMetricsByWorkload(t *testing.T) {
+	cm := getTestGroupClusterMetric()
+	cm.addWorkloads(map[string]workloadRef{
+		"kube-system-dns":   {kind: "Deployment", name: "kube-dns"},
+		"kube-system-proxy": {kind: "Deployment", name: "kube-dns"},
+	})
+
+	groups := cm.getSortedGroupMetrics(WorkloadGrouping, "name")
+	assert.Len(t, groups, 2)
+
+	assert.Equal(t, "Pod/web", groups[0].workloadString())
+	assert.Equal(t, int64(1), groups[0].podCount.current)
+
+	assert.Equal(t, "Deployment/kube-dns", groups[1].workloadString())
+	assert.Equal(t, "kube-system", groups[1].namespace)
+	assert.Equal(t, int64(2), groups[1].podCount.current)
+	assert.Equal(t, "700m (35%%)", groups[1].resources["cpu"].requestString(false))
+
+	lp := listPrinter{
+		cm:       &cm,
+		showPods: true,
+		groupBy:  WorkloadGrouping,
+	}
+
+	lcm := lp.buildListClusterMetrics()
+	assert.Len(t, lcm.Workloads, 2)
+	assert.Equal(t, "Deployment", lcm.Workloads[1].Kind)
+	assert.Equal(t, int64(2), lcm.Workloads[1].Replicas)
+	assert.Len(t, lcm.Workloads[1].Pods, 2)
+}
+
+func controllerRef(kind, name string) metav1.OwnerReference {
+	isController := true
+	return metav1.OwnerReference{
+		Kind:       kind,
+		Name:       name,
+		Controller: &isController,
+	}
+}
+
+func ownedPod(name string, owners ...metav1.OwnerReference) *corev1.Pod {
+	p := pod("mynode", "default", name, nil)
+	p.OwnerReferences = owners
+	return p
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robscott/kube-capacity/pkg/capacity"
+	"github.com/spf13/cobra"
+)
+
+var drainNodes []string
+var drainSelector string
+
+func init() {
+	drainSimCmd.Flags().StringSliceVarP(&drainNodes,
+		"nodes", "", []string{}, "comma separated list of nodes to drain")
+	drainSimCmd.Flags().StringVarP(&drainSelector,
+		"selector", "", "", "labels of nodes to drain (e.g. node.kubernetes.io/instance-type=m5.large)")
+
+	rootCmd.AddCommand(drainSimCmd)
+}
+
+var drainSimCmd = &cobra.Command{
+	Use:   "drain-sim",
+	Short: "Simulate draining nodes and show whether their pods can be rescheduled",
+	Long: "Simulate draining nodes by removing them and placing their pods, other than DaemonSet and mirror pods, " +
+		"on the remaining nodes based on requests, node selectors, node affinity and tolerations. " +
+		"Exits with code 8 if any pods would become unschedulable.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputTypes(outputFormat, structuredOutputs); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if len(drainNodes) == 0 && drainSelector == "" {
+			fmt.Println("Nodes to drain must be specified with --nodes or --selector")
+			os.Exit(1)
+		}
+
+		resourceNames, err := parseResources(resources)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validateSortBy(sortBy, resourceNames); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		opts := capacity.Options{
+			KubeContext:    kubeContext,
+			KubeConfig:     kubeConfig,
+			NodeLabels:     nodeLabels,
+			ResourceNames:  resourceNames,
+			RequestTimeout: requestTimeout,
+			ChunkSize:      chunkSize,
+		}
+		printOpts := capacity.PrintOptions{
+			Output:          outputFormat,
+			SortBy:          sortBy,
+			ShowPods:        showPods,
+			ShowPodCount:    showPodCount,
+			AvailableFormat: availableFormat,
+		}
+
+		exitOnError(capacity.FetchAndPrintDrainSim(cmd.Context(), os.Stdout, opts, printOpts,
+			capacity.DrainOptions{Nodes: drainNodes, Selector: drainSelector}))
+	},
+}
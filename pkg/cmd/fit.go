@@ -0,0 +1,89 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robscott/kube-capacity/pkg/capacity"
+	"github.com/spf13/cobra"
+)
+
+var fitFilename string
+var fitCPU string
+var fitMemory string
+var fitRequests []string
+var fitReplicas int64
+var fitNodeSelector string
+var fitTolerations []string
+
+func init() {
+	fitCmd.Flags().StringVarP(&fitFilename,
+		"filename", "f", "", "manifest with Deployments, StatefulSets, ReplicaSets, Jobs or Pods to check (- for stdin)")
+	fitCmd.Flags().StringVarP(&fitCPU,
+		"cpu", "", "", "CPU requested by each pod (e.g. 500m)")
+	fitCmd.Flags().StringVarP(&fitMemory,
+		"memory", "", "", "memory requested by each pod (e.g. 1Gi)")
+	fitCmd.Flags().StringSliceVarP(&fitRequests,
+		"request", "", []string{}, "other resources requested by each pod (e.g. nvidia.com/gpu=1)")
+	fitCmd.Flags().Int64VarP(&fitReplicas,
+		"replicas", "", 0, "number of replicas that need to fit")
+	fitCmd.Flags().StringVarP(&fitNodeSelector,
+		"node-selector", "", "", "node selector of the pods (e.g. disktype=ssd)")
+	fitCmd.Flags().StringSliceVarP(&fitTolerations,
+		"toleration", "", []string{}, "tolerations of the pods in the form key[=value][:effect]")
+
+	rootCmd.AddCommand(fitCmd)
+}
+
+var fitCmd = &cobra.Command{
+	Use:   "fit",
+	Short: "Show how many more pods of a given shape can be scheduled",
+	Long: "Show how many more pods of a given shape can be scheduled on each node based on allocatable resources minus requests. " +
+		"With --filename, estimates where the replicas of the workloads in a manifest would be placed. " +
+		"Exits with code 8 if the requested replicas do not fit.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateOutputTypes(outputFormat, structuredOutputs); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if fitFilename != "" && (fitCPU != "" || fitMemory != "" || len(fitRequests) > 0 || fitReplicas > 0 ||
+			fitNodeSelector != "" || len(fitTolerations) > 0) {
+			fmt.Println("--filename cannot be combined with flags describing the pod shape")
+			os.Exit(1)
+		}
+
+		opts := capacity.Options{
+			KubeContext:    kubeContext,
+			KubeConfig:     kubeConfig,
+			NodeLabels:     nodeLabels,
+			RequestTimeout: requestTimeout,
+			ChunkSize:      chunkSize,
+		}
+		fitOpts := capacity.FitOptions{
+			Filename:     fitFilename,
+			CPU:          fitCPU,
+			Memory:       fitMemory,
+			Requests:     fitRequests,
+			Replicas:     fitReplicas,
+			NodeSelector: fitNodeSelector,
+			Tolerations:  fitTolerations,
+		}
+
+		exitOnError(capacity.FetchAndPrintFit(cmd.Context(), os.Stdout, opts, capacity.PrintOptions{Output: outputFormat}, fitOpts))
+	},
+}
@@ -15,8 +15,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/robscott/kube-capacity/pkg/capacity"
 	"github.com/spf13/cobra"
@@ -26,6 +32,7 @@ var showContainers bool
 var showPods bool
 var showUtil bool
 var showPodCount bool
+var showOverhead bool
 var podLabels string
 var nodeLabels string
 var namespaceLabels string
@@ -35,6 +42,28 @@ var kubeConfig string
 var outputFormat string
 var sortBy string
 var availableFormat bool
+var resources string
+var groupBy string
+var groupByNodeLabel string
+var watch bool
+var watchInterval time.Duration
+var outputVersion string
+var requestTimeout time.Duration
+var chunkSize int64
+var fieldSelector string
+var showPending bool
+
+// exitCodeDoesNotFit is returned when simulated pods do not fit in the
+// cluster, so that fit checks can gate CI pipelines.
+const exitCodeDoesNotFit = 8
+
+// exitCodeInterrupted is returned when interrupted before finishing, like a
+// shell does for SIGINT.
+const exitCodeInterrupted = 130
+
+// structuredOutputs are the output formats supported by subcommands whose
+// output is not a flat list of rows.
+var structuredOutputs = []string{capacity.TableOutput, capacity.JSONOutput, capacity.YAMLOutput}
 
 var rootCmd = &cobra.Command{
 	Use:   "kube-capacity",
@@ -50,8 +79,71 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		capacity.FetchAndPrint(showContainers, showPods, showUtil, showPodCount, availableFormat, podLabels, nodeLabels,
-			namespaceLabels, namespace, kubeContext, kubeConfig, outputFormat, sortBy)
+		if err := validateGroupBy(groupBy, groupByNodeLabel); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validateFlatOutput(outputFormat, groupBy, groupByNodeLabel, showPending); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validateWatch(watch, watchInterval, outputFormat); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validatePending(showPending, groupBy); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validateOutputVersion(outputVersion, outputFormat); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		resourceNames, err := parseResources(resources)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if err := validateSortBy(sortBy, resourceNames); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		opts := capacity.Options{
+			KubeContext:     kubeContext,
+			KubeConfig:      kubeConfig,
+			PodLabels:       podLabels,
+			FieldSelector:   fieldSelector,
+			Pending:         showPending,
+			NodeLabels:      nodeLabels,
+			NamespaceLabels: namespaceLabels,
+			Namespace:       namespace,
+			ResourceNames:   resourceNames,
+			Utilization:     showUtil,
+			RequestTimeout:  requestTimeout,
+			ChunkSize:       chunkSize,
+		}
+		printOpts := capacity.PrintOptions{
+			Output:           outputFormat,
+			OutputVersion:    outputVersion,
+			SortBy:           sortBy,
+			GroupBy:          groupBy,
+			GroupByNodeLabel: groupByNodeLabel,
+			ShowPods:         showPods,
+			ShowContainers:   showContainers,
+			ShowUtil:         showUtil,
+			ShowOverhead:     showOverhead,
+			ShowPodCount:     showPodCount,
+			AvailableFormat:  availableFormat,
+		}
+
+		exitOnError(capacity.FetchAndPrint(cmd.Context(), opts, printOpts, watch, watchInterval))
 	},
 }
 
@@ -68,6 +160,8 @@ func init() {
 		"available", "a", false, "includes quantity available instead of percentage used")
 	rootCmd.PersistentFlags().StringVarP(&podLabels,
 		"pod-labels", "l", "", "labels to filter pods with")
+	rootCmd.PersistentFlags().StringVarP(&fieldSelector,
+		"field-selector", "", "", "fields to filter pods with (e.g. spec.nodeName=node-1), completed pods are always excluded")
 	rootCmd.PersistentFlags().StringVarP(&nodeLabels,
 		"node-labels", "", "", "labels to filter nodes with")
 	rootCmd.PersistentFlags().StringVarP(&namespaceLabels,
@@ -80,26 +174,261 @@ func init() {
 		"kubeconfig", "", "", "kubeconfig file to use for Kubernetes config")
 	rootCmd.PersistentFlags().StringVarP(&sortBy,
 		"sort", "", "name",
-		fmt.Sprintf("attribute to sort results by (supports: %v)", capacity.SupportedSortAttributes))
+		fmt.Sprintf("attribute to sort results by, for a resource included in --resources (supports: %v)",
+			capacity.SupportedSortAttributes))
+	rootCmd.PersistentFlags().StringVarP(&resources,
+		"resources", "", strings.Join(capacity.DefaultResources, ","),
+		"comma separated list of resources to include in output (e.g. cpu,memory,nvidia.com/gpu)")
+	rootCmd.PersistentFlags().StringVarP(&groupBy,
+		"group-by", "", capacity.NodeGrouping,
+		fmt.Sprintf("group results by (supports: %v)", capacity.SupportedGroupings()))
+	rootCmd.PersistentFlags().StringVarP(&groupByNodeLabel,
+		"group-by-node-label", "", "", "node label key to group nodes by (e.g. topology.kubernetes.io/zone)")
+	rootCmd.PersistentFlags().DurationVarP(&requestTimeout,
+		"request-timeout", "", 0, "how long to wait for each request to the API server, 0 waits forever")
+	rootCmd.PersistentFlags().Int64VarP(&chunkSize,
+		"chunk-size", "", 500, "return large lists in chunks rather than all at once, 0 disables chunking")
+	rootCmd.Flags().BoolVarP(&showOverhead,
+		"overhead", "", false, "includes pod overhead from RuntimeClasses in output, with totals for each RuntimeClass")
+	rootCmd.Flags().BoolVarP(&showPending,
+		"pending", "", false, "includes pods that are not scheduled on a node yet as a <pending> node")
+	rootCmd.Flags().BoolVarP(&watch,
+		"watch", "w", false, "refresh the output every interval, highlighting values that changed")
+	rootCmd.Flags().DurationVarP(&watchInterval,
+		"interval", "", 10*time.Second, "how often to refresh the output in watch mode")
+	rootCmd.Flags().StringVarP(&outputVersion,
+		"output-version", "", capacity.OutputVersionV1,
+		fmt.Sprintf("version of JSON, YAML and template output (supports: %v)", capacity.SupportedOutputVersions()))
 
 	rootCmd.PersistentFlags().StringVarP(&outputFormat,
 		"output", "o", capacity.TableOutput,
-		fmt.Sprintf("output format for information (supports: %v)", capacity.SupportedOutputs()))
+		fmt.Sprintf("output format for information (supports: %v, or %v followed by =<template>)",
+			capacity.SupportedOutputs(), capacity.TemplateOutputs()))
 }
 
 // Execute is the primary entrypoint for this CLI
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	// The first interrupt cancels the context so that commands can stop
+	// cleanly, a second one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
+// exitOnError prints the error and exits with a code describing what failed.
+// Nothing is printed when simulated pods do not fit, as the output says so.
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Interrupted")
+		os.Exit(exitCodeInterrupted)
+	}
+
+	if !errors.Is(err, capacity.ErrDoesNotFit) {
+		fmt.Println(err)
+	}
+	if errors.Is(err, capacity.ErrMetricsUnavailable) {
+		fmt.Println("For this to work, metrics-server needs to be running in your cluster")
+	}
+
+	os.Exit(exitCode(err))
+}
+
+func exitCode(err error) int {
+	if errors.Is(err, capacity.ErrDoesNotFit) {
+		return exitCodeDoesNotFit
+	}
+
+	var capacityErr *capacity.Error
+	if errors.As(err, &capacityErr) {
+		switch capacityErr.Op {
+		case capacity.OpListNodes:
+			return 2
+		case capacity.OpListPods, capacity.OpListNamespaces:
+			return 3
+		case capacity.OpConnectMetrics:
+			return 4
+		case capacity.OpPodMetrics:
+			return 6
+		case capacity.OpNodeMetrics:
+			return 7
+		}
+	}
+
+	return 1
+}
+
 func validateOutputType(outputType string) error {
-	for _, format := range capacity.SupportedOutputs() {
+	if _, arg, ok := capacity.ParseTemplateOutput(outputType); ok {
+		if arg == "" {
+			return fmt.Errorf("A template must be specified, e.g. --output jsonpath={.clusterTotals.cpu.requests}")
+		}
+		return nil
+	}
+
+	err := validateOutputTypes(outputType, capacity.SupportedOutputs())
+	if err != nil {
+		return fmt.Errorf("%v, or %v followed by =<template>", err, capacity.TemplateOutputs())
+	}
+	return nil
+}
+
+// validateOutputTypes validates the output type for subcommands that only
+// support some of the output formats.
+func validateOutputTypes(outputType string, supported []string) error {
+	for _, format := range supported {
 		if format == outputType {
 			return nil
 		}
 	}
-	return fmt.Errorf("Unsupported Output Type. We only support: %v", capacity.SupportedOutputs())
+	return fmt.Errorf("Unsupported Output Type. We only support: %v", supported)
+}
+
+// validateFlatOutput rejects options that CSV, TSV and custom columns output
+// cannot show, as it has a single row for each node, pod or container. This
+// includes pending pods, which are not on a node.
+func validateFlatOutput(outputType, groupBy, groupByNodeLabel string, pending bool) error {
+	format := outputType
+	if f, _, ok := capacity.ParseTemplateOutput(outputType); ok {
+		format = f
+	}
+
+	switch format {
+	case capacity.CSVOutput, capacity.TSVOutput, capacity.CustomColumnsOutput, capacity.CustomColumnsFileOutput:
+	default:
+		return nil
+	}
+
+	if groupBy != capacity.NodeGrouping || groupByNodeLabel != "" {
+		return fmt.Errorf("%s output does not support --group-by or --group-by-node-label", format)
+	}
+	if pending {
+		return fmt.Errorf("%s output does not support --pending", format)
+	}
+	return nil
+}
+
+// validateOutputVersion validates the output version, which only applies to
+// output built from the JSON structure.
+func validateOutputVersion(outputVersion, outputType string) error {
+	supported := false
+	for _, version := range capacity.SupportedOutputVersions() {
+		if version == outputVersion {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("Unsupported Output Version. We only support: %v", capacity.SupportedOutputVersions())
+	}
+
+	if outputVersion == capacity.OutputVersionV1 {
+		return nil
+	}
+
+	format := outputType
+	if f, _, ok := capacity.ParseTemplateOutput(outputType); ok {
+		format = f
+	}
+
+	switch format {
+	case capacity.JSONOutput, capacity.YAMLOutput, capacity.GoTemplateOutput, capacity.GoTemplateFileOutput, capacity.JSONPathOutput:
+		return nil
+	}
+	return fmt.Errorf("--output-version %s is only supported with json, yaml, go-template and jsonpath output", outputVersion)
+}
+
+func validateGroupBy(groupBy, groupByNodeLabel string) error {
+	if groupByNodeLabel != "" && groupBy != capacity.NodeGrouping {
+		return fmt.Errorf("--group-by-node-label can only be used when grouping by %s", capacity.NodeGrouping)
+	}
+
+	for _, grouping := range capacity.SupportedGroupings() {
+		if grouping == groupBy {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unsupported Grouping. We only support: %v", capacity.SupportedGroupings())
+}
+
+func validateWatch(watch bool, interval time.Duration, outputType string) error {
+	if !watch {
+		return nil
+	}
+
+	if outputType != capacity.TableOutput {
+		return fmt.Errorf("--watch is only supported with %s output", capacity.TableOutput)
+	}
+
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be greater than 0")
+	}
+	return nil
+}
+
+// validatePending rejects grouping pods along with pending pods, as pending
+// pods are shown as a node of their own and would be left out of the groups.
+func validatePending(pending bool, groupBy string) error {
+	if pending && groupBy != capacity.NodeGrouping {
+		return fmt.Errorf("--pending is only supported with --group-by %s", capacity.NodeGrouping)
+	}
+	return nil
+}
+
+// validateSortBy rejects sorting by a resource that is not included in the
+// output, which would leave the results sorted by name.
+func validateSortBy(sortBy string, resourceNames []string) error {
+	if sortBy == "name" {
+		return nil
+	}
+
+	attribute := strings.TrimSuffix(sortBy, ".percentage")
+	i := strings.LastIndex(attribute, ".")
+	if i <= 0 {
+		return fmt.Errorf("Unsupported sort attribute %s. We only support: name, or <resource>.<util|request|limit>, "+
+			"optionally followed by .percentage", sortBy)
+	}
+
+	resourceName, metric := attribute[:i], attribute[i+1:]
+	if metric != "util" && metric != "request" && metric != "limit" {
+		return fmt.Errorf("Unsupported sort attribute %s. We only support: name, or <resource>.<util|request|limit>, "+
+			"optionally followed by .percentage", sortBy)
+	}
+	if resourceName == "mem" {
+		resourceName = "memory"
+	}
+
+	for _, name := range resourceNames {
+		if name == resourceName {
+			return nil
+		}
+	}
+	return fmt.Errorf("--sort %s requires %s to be included in --resources", sortBy, resourceName)
+}
+
+func parseResources(resources string) ([]string, error) {
+	resourceNames := []string{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(resources, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		resourceNames = append(resourceNames, name)
+	}
+
+	if len(resourceNames) == 0 {
+		return nil, fmt.Errorf("At least one resource must be specified with --resources")
+	}
+	return resourceNames, nil
 }
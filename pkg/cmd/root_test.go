@@ -0,0 +1,123 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOutputType(t *testing.T) {
+	assert.NoError(t, validateOutputType("table"))
+	assert.NoError(t, validateOutputType("csv"))
+	assert.NoError(t, validateOutputType("jsonpath={.clusterTotals.cpu.requests}"))
+	assert.EqualError(t, validateOutputType("jsonpath="),
+		"A template must be specified, e.g. --output jsonpath={.clusterTotals.cpu.requests}")
+	assert.Error(t, validateOutputType("xml"))
+
+	assert.NoError(t, validateOutputTypes("json", []string{"table", "json"}))
+	assert.EqualError(t, validateOutputTypes("csv", []string{"table", "json"}),
+		"Unsupported Output Type. We only support: [table json]")
+}
+
+func TestValidateFlatOutput(t *testing.T) {
+	var testCases = []struct {
+		outputType       string
+		groupBy          string
+		groupByNodeLabel string
+		pending          bool
+		err              string
+	}{
+		{"csv", "node", "", false, ""},
+		{"custom-columns=NODE:.node", "node", "", false, ""},
+		{"csv", "namespace", "", false, "csv output does not support --group-by or --group-by-node-label"},
+		{"tsv", "node", "topology.kubernetes.io/zone", false, "tsv output does not support --group-by or --group-by-node-label"},
+		{"csv", "node", "", true, "csv output does not support --pending"},
+		{"custom-columns=NODE:.node", "node", "", true, "custom-columns output does not support --pending"},
+		{"table", "namespace", "", true, ""},
+		{"json", "node", "", true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.outputType, func(t *testing.T) {
+			err := validateFlatOutput(tc.outputType, tc.groupBy, tc.groupByNodeLabel, tc.pending)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestValidateOutputVersion(t *testing.T) {
+	assert.NoError(t, validateOutputVersion("v1", "table"))
+	assert.NoError(t, validateOutputVersion("v2", "json"))
+	assert.NoError(t, validateOutputVersion("v2", "jsonpath={.nodes}"))
+	assert.Error(t, validateOutputVersion("v3", "json"))
+	assert.EqualError(t, validateOutputVersion("v2", "table"),
+		"--output-version v2 is only supported with json, yaml, go-template and jsonpath output")
+}
+
+func TestValidateGroupBy(t *testing.T) {
+	assert.NoError(t, validateGroupBy("node", ""))
+	assert.NoError(t, validateGroupBy("node", "topology.kubernetes.io/zone"))
+	assert.NoError(t, validateGroupBy("workload", ""))
+	assert.EqualError(t, validateGroupBy("namespace", "topology.kubernetes.io/zone"),
+		"--group-by-node-label can only be used when grouping by node")
+	assert.Error(t, validateGroupBy("cluster", ""))
+}
+
+func TestValidateWatch(t *testing.T) {
+	assert.NoError(t, validateWatch(false, 0, "json"))
+	assert.NoError(t, validateWatch(true, time.Second, "table"))
+	assert.EqualError(t, validateWatch(true, time.Second, "json"), "--watch is only supported with table output")
+	assert.EqualError(t, validateWatch(true, 0, "table"), "--interval must be greater than 0")
+}
+
+func TestValidatePending(t *testing.T) {
+	assert.NoError(t, validatePending(false, "namespace"))
+	assert.NoError(t, validatePending(true, "node"))
+	assert.EqualError(t, validatePending(true, "namespace"), "--pending is only supported with --group-by node")
+	assert.EqualError(t, validatePending(true, "workload"), "--pending is only supported with --group-by node")
+}
+
+func TestValidateSortBy(t *testing.T) {
+	resourceNames := []string{"cpu", "memory", "nvidia.com/gpu"}
+
+	assert.NoError(t, validateSortBy("name", resourceNames))
+	assert.NoError(t, validateSortBy("cpu.util", resourceNames))
+	assert.NoError(t, validateSortBy("mem.request.percentage", resourceNames))
+	assert.NoError(t, validateSortBy("nvidia.com/gpu.limit", resourceNames))
+	assert.NoError(t, validateSortBy("ephemeral-storage.request", append(resourceNames, "ephemeral-storage")))
+
+	assert.EqualError(t, validateSortBy("ephemeral-storage.util", resourceNames),
+		"--sort ephemeral-storage.util requires ephemeral-storage to be included in --resources")
+	assert.EqualError(t, validateSortBy("cpu.request", []string{"memory"}),
+		"--sort cpu.request requires cpu to be included in --resources")
+	assert.Error(t, validateSortBy("cpu.usage", resourceNames))
+	assert.Error(t, validateSortBy("age", resourceNames))
+}
+
+func TestParseResources(t *testing.T) {
+	resourceNames, err := parseResources(" cpu, memory,,cpu,nvidia.com/gpu")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu", "memory", "nvidia.com/gpu"}, resourceNames)
+
+	_, err = parseResources(" , ")
+	assert.EqualError(t, err, "At least one resource must be specified with --resources")
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/robscott/kube-capacity/pkg/api"
+	"github.com/robscott/kube-capacity/pkg/capacity"
+	"github.com/spf13/cobra"
+)
+
+var schemaVersion string
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaVersion,
+		"output-version", "", capacity.OutputVersionV1,
+		fmt.Sprintf("version of the output to print the schema of (supports: %v)", api.Versions()))
+
+	rootCmd.AddCommand(schemaCmd)
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of JSON and YAML output",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cmd.ParseFlags(args); err != nil {
+			fmt.Printf("Error parsing flags: %v", err)
+		}
+
+		schema, err := api.Schema(schemaVersion)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", schema)
+	},
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Kube Capacity Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/robscott/kube-capacity/pkg/capacity"
+	"github.com/spf13/cobra"
+)
+
+var serveListen string
+var serveInterval time.Duration
+
+func init() {
+	serveCmd.Flags().StringVarP(&serveListen,
+		"listen", "", ":9090", "address to serve Prometheus metrics on")
+	serveCmd.Flags().DurationVarP(&serveInterval,
+		"interval", "", 30*time.Second, "how often to refresh the metrics")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve resource requests, limits, and utilization as Prometheus metrics",
+	Long: "Serve the resource requests, limits, allocatable, utilization and pod counts of the cluster, nodes, " +
+		"namespaces, pods and containers as Prometheus metrics on /metrics. Pods and nodes are watched with " +
+		"informers, so scrapes do not list them from the API server.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if serveInterval <= 0 {
+			fmt.Println("--interval must be greater than 0")
+			os.Exit(1)
+		}
+
+		resourceNames, err := parseResources(resources)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		opts := capacity.Options{
+			KubeContext:     kubeContext,
+			KubeConfig:      kubeConfig,
+			PodLabels:       podLabels,
+			FieldSelector:   fieldSelector,
+			NodeLabels:      nodeLabels,
+			NamespaceLabels: namespaceLabels,
+			Namespace:       namespace,
+			ResourceNames:   resourceNames,
+			Utilization:     showUtil,
+			RequestTimeout:  requestTimeout,
+			ChunkSize:       chunkSize,
+		}
+
+		exitOnError(capacity.Serve(cmd.Context(), os.Stderr, opts, serveListen, serveInterval))
+	},
+}
@@ -54,3 +54,24 @@ func getKubeConfig(kubeContext, kubeConfig string) (*rest.Config, error) {
 		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
 	).ClientConfig()
 }
+
+// CurrentContext returns the name of the Kubernetes context in use
+func CurrentContext(kubeContext, kubeConfig string) (string, error) {
+	if kubeContext != "" {
+		return kubeContext, nil
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeConfig != "" {
+		loadingRules.ExplicitPath = kubeConfig
+	}
+	rawConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{},
+	).RawConfig()
+	if err != nil {
+		return "", err
+	}
+
+	return rawConfig.CurrentContext, nil
+}